@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchResult summarizes a batch of exchanges run by RunN
+type BatchResult struct {
+	Succeeded int
+	Failed    int
+	// SolveTimes holds the solve times of the successful exchanges, it is nil
+	// unless SolveHistogram is enabled
+	SolveTimes *solveTimeHistogram
+}
+
+// RunN runs n exchanges with the server, at most concurrency at a time
+func (c *WordOfWisdomClient) RunN(ctx context.Context, n, concurrency int) *BatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	batch := &BatchResult{}
+	if c.config.SolveHistogram {
+		batch.SolveTimes = &solveTimeHistogram{}
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	requests := make(chan struct{})
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range requests {
+				result, err := c.RunWithRetry(ctx)
+
+				mu.Lock()
+				if err != nil {
+					batch.Failed++
+				} else {
+					batch.Succeeded++
+				}
+				mu.Unlock()
+
+				if err == nil && batch.SolveTimes != nil {
+					batch.SolveTimes.Observe(result.SolveTime)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		requests <- struct{}{}
+	}
+	close(requests)
+	wg.Wait()
+
+	return batch
+}
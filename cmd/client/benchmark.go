@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+)
+
+// BenchmarkResult is the median time to solve a challenge of a difficulty
+type BenchmarkResult struct {
+	Difficulty int
+	Runs       int
+	Median     time.Duration
+}
+
+// Benchmark solves runs random challenges offline for every difficulty from
+// minDifficulty to maxDifficulty, helping to pick a difficulty suited to the
+// hardware
+func (c *WordOfWisdomClient) Benchmark(ctx context.Context, minDifficulty, maxDifficulty, runs int) ([]BenchmarkResult, error) {
+	if minDifficulty < 0 || minDifficulty > maxDifficulty || maxDifficulty > pow.MaxDifficulty {
+		return nil, fmt.Errorf("difficulty range [%d, %d] out of range [0, %d]", minDifficulty, maxDifficulty, pow.MaxDifficulty)
+	}
+	if runs < 1 {
+		return nil, fmt.Errorf("benchmark runs must be positive, got %d", runs)
+	}
+
+	results := make([]BenchmarkResult, 0, maxDifficulty-minDifficulty+1)
+	for difficulty := minDifficulty; difficulty <= maxDifficulty; difficulty++ {
+		times := make([]time.Duration, 0, runs)
+		for range runs {
+			challenge, err := randomChallenge()
+			if err != nil {
+				return nil, err
+			}
+
+			start := time.Now()
+			if _, _, err := c.solvePoW(ctx, challenge, start.UTC(), "", pow.NonceDecimal, difficulty); err != nil {
+				return nil, err
+			}
+			times = append(times, time.Since(start))
+		}
+
+		slices.Sort(times)
+		results = append(results, BenchmarkResult{Difficulty: difficulty, Runs: runs, Median: times[len(times)/2]})
+	}
+
+	return results, nil
+}
+
+// randomChallenge returns a random challenge for offline solving
+func randomChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// writeBenchmark writes the benchmark results as a table
+func writeBenchmark(w io.Writer, results []BenchmarkResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DIFFICULTY\tRUNS\tMEDIAN SOLVE TIME")
+	for _, result := range results {
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\n", result.Difficulty, result.Runs, result.Median)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestBenchmarkSweep(t *testing.T) {
+	c := NewClient(testClientConfig(), zap.NewNop())
+
+	results, err := c.Benchmark(context.Background(), 1, 4, 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("%d results, want one per difficulty from 1 to 4", len(results))
+	}
+	for i, result := range results {
+		if result.Difficulty != i+1 || result.Runs != 9 {
+			t.Errorf("result %d is for difficulty %d over %d runs", i, result.Difficulty, result.Runs)
+		}
+	}
+
+	// Every digit multiplies the work by 16, so even with noisy timings the
+	// times grow across the sweep
+	if first, last := results[0].Median, results[len(results)-1].Median; last <= first {
+		t.Errorf("median %s at difficulty 4 not above %s at difficulty 1", last, first)
+	}
+	if results[3].Median < results[2].Median {
+		t.Errorf("median %s at difficulty 4 below %s at difficulty 3", results[3].Median, results[2].Median)
+	}
+
+	if _, err := c.Benchmark(context.Background(), 3, 2, 1); err == nil {
+		t.Error("reversed difficulty range accepted")
+	}
+}
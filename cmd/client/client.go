@@ -1,183 +1,526 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/protocol"
 	"go.uber.org/zap"
 )
 
+// Dialer opens a connection to the server
+type Dialer func(ctx context.Context) (net.Conn, error)
+
 // WordOfWisdomClient is a client that connects to the server and solves PoW challenges
 type WordOfWisdomClient struct {
-	config config.ClientConfig
-	logger *zap.Logger
+	config   config.ClientConfig
+	logger   *zap.Logger
+	dial     Dialer
+	resolver srvResolver
+	// solvers is shared by all exchanges, so that concurrent ones don't
+	// multiply the solving goroutines
+	solvers *solverPool
+	// layout assembles the hashed data, pow.CanonicalLayout when nil
+	layout pow.DataLayout
 }
 
 // NewClient initializes a new client with the given configuration and logger
 func NewClient(cfg config.ClientConfig, logger *zap.Logger) *WordOfWisdomClient {
-	return &WordOfWisdomClient{
-		config: cfg,
-		logger: logger,
+	cfg.ApplyDefaults()
+
+	workers := cfg.SolverWorkers
+	if workers == 0 {
+		workers = runtime.NumCPU()
+	}
+
+	c := &WordOfWisdomClient{
+		config:   cfg,
+		logger:   logger,
+		resolver: net.DefaultResolver,
+		solvers:  newSolverPool(workers),
+	}
+	c.dial = c.dialTCP
+	if cfg.SRVRecord != "" {
+		c.dial = c.dialSRV
 	}
+
+	return c
+}
+
+// UseDataLayout makes the client hash its solutions with the given layout
+// instead of the canonical one; the server must use the same
+func (c *WordOfWisdomClient) UseDataLayout(layout pow.DataLayout) {
+	c.layout = layout
+}
+
+// UseDialer makes the client connect with dial instead of over TCP to the
+// configured address, e.g. to an in-process server over loopback
+func (c *WordOfWisdomClient) UseDialer(dial Dialer) {
+	c.dial = dial
+}
+
+// dialTCP connects to the configured server address over TCP
+func (c *WordOfWisdomClient) dialTCP(ctx context.Context) (net.Conn, error) {
+	var d net.Dialer
+
+	return d.DialContext(ctx, "tcp", c.config.ServerAddress)
+}
+
+// Result describes a completed exchange with the server
+type Result struct {
+	Challenge  string
+	Difficulty int
+	Nonce      string
+	Attempts   int
+	SolveTime  time.Duration
+	Quote      string
 }
 
 // Run starts the client, solves the PoW challenge, and interacts with the server
-func (c *WordOfWisdomClient) Run(ctx context.Context) error {
-	conn, err := net.Dial("tcp", c.config.ServerAddress)
+func (c *WordOfWisdomClient) Run(ctx context.Context) (*Result, error) {
+	results, err := c.RunChained(ctx, 1)
 	if err != nil {
-		return fmt.Errorf("failed to connect to server: %w", err)
+		return nil, err
 	}
 
-	defer func() {
+	return results[0], nil
+}
+
+// RunChained fetches up to n quotes over a single connection, asking the
+// server for the next challenge along with every quote but the last. Fewer
+// results are returned when the server ends the chain early
+func (c *WordOfWisdomClient) RunChained(ctx context.Context, n int) ([]*Result, error) {
+	// Every exchange gets ConnectionTimeout, the chain as a whole no more
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(n)*c.config.ConnectionTimeout)
+	defer cancel()
+
+	conn, reader, closeConn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeConn()
+
+	results := make([]*Result, 0, n)
+	for len(results) < n {
+		request := followNone
+		if len(results)+1 < n {
+			request = followNext
+		}
+
+		result, err := c.exchange(ctx, conn, reader, request)
+		if err != nil && len(results) > 0 && errors.Is(err, io.EOF) {
+			c.logger.Warn("Server ended the chain", zap.Int("quotes", len(results)))
+
+			break
+		}
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, result)
+
+		// Authenticated clients get no next challenge
+		if result.Challenge == "" {
+			break
+		}
+	}
+
+	return results, nil
+}
+
+// connect dials the server and gets the connection ready for exchanges,
+// returning a func that closes it
+func (c *WordOfWisdomClient) connect(ctx context.Context) (net.Conn, *bufio.Reader, func(), error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, nil, nil, wrapError(ctx, phaseConnect, fmt.Errorf("failed to connect to server: %w", err))
+	}
+
+	// Unblock any pending read or write once ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	closeConn := func() {
+		stop()
 		_ = conn.Close()
-	}()
+	}
+
+	c.logger.Info("Connected to server", zap.String("address", conn.RemoteAddr().String()))
+
+	reader := bufio.NewReaderSize(conn, c.config.ReadBufferBytes)
+
+	if c.config.AuthToken != "" {
+		if _, err := conn.Write([]byte("Auth:" + c.config.AuthToken + "\n")); err != nil {
+			c.logger.Error("Failed to send auth token", zap.Error(err))
+			closeConn()
 
-	c.logger.Info("Connected to server", zap.String("address", c.config.ServerAddress))
+			return nil, nil, nil, wrapError(ctx, phaseChallenge, err)
+		}
+	}
+
+	if err := c.checkBanner(conn, reader); err != nil {
+		c.logger.Error("Unexpected banner", zap.Error(err))
+		closeConn()
+
+		return nil, nil, nil, wrapError(ctx, phaseChallenge, err)
+	}
+
+	return conn, reader, closeConn, nil
+}
+
+// checkBanner consumes the banner the server may send first, making sure it
+// is the expected one when ExpectedBanner is set
+func (c *WordOfWisdomClient) checkBanner(conn net.Conn, reader *bufio.Reader) error {
+	if err := conn.SetDeadline(time.Now().Add(c.config.ConnectionTimeout)); err != nil {
+		c.logger.Warn("set deadline failed", zap.Error(err))
+	}
+
+	line, err := peekLine(reader)
+	if err != nil {
+		return err
+	}
 
+	// Every other first message starts with a key
+	banner := strings.TrimSpace(line)
+	for _, prefix := range []string{"Challenge:", "Quote:", "Error:"} {
+		if strings.HasPrefix(banner, prefix) {
+			banner = ""
+
+			break
+		}
+	}
+
+	if banner != "" {
+		if _, err := reader.Discard(len(line)); err != nil {
+			return err
+		}
+		c.logger.Info("Banner received", zap.String("banner", banner))
+	}
+
+	if c.config.ExpectedBanner != "" && banner != c.config.ExpectedBanner {
+		return fmt.Errorf("expected banner %q, got %q", c.config.ExpectedBanner, banner)
+	}
+
+	return nil
+}
+
+// exchange receives a challenge, solves it and returns the server's answer;
+// request asks the server for more after the quote
+func (c *WordOfWisdomClient) exchange(ctx context.Context, conn net.Conn, reader *bufio.Reader, request followUp) (*Result, error) {
 	// Set connection timeout
-	err = conn.SetDeadline(time.Now().Add(c.config.ConnectionTimeout))
+	err := conn.SetDeadline(time.Now().Add(c.config.ConnectionTimeout))
 	if err != nil {
 		c.logger.Warn("set deadline failed", zap.Error(err))
 	}
 
-	// Receive challenge from server
-	challenge, serverTimestamp, difficulty, err := c.receiveChallenge(conn)
+	// Receive challenge from server, authenticated clients get a quote instead
+	message, err := readMessage(reader, c.config.MaxMessageBytes)
+	if err != nil {
+		// The server closing the connection ends a chain, the caller decides
+		if !errors.Is(err, io.EOF) {
+			c.logger.Error("Failed to receive challenge", zap.Error(err))
+		}
+
+		return nil, wrapError(ctx, phaseChallenge, err)
+	}
+	if quote, ok := strings.CutPrefix(message, "Quote:"); ok {
+		c.logger.Info("Received quote without challenge", zap.String("quote", quote))
+
+		return &Result{Quote: quote}, nil
+	}
+	if payload, ok := strings.CutPrefix(message, "Error:"); ok {
+		err := newServerError(payload)
+		c.logger.Warn("Received error from server", zap.Error(err))
+
+		return nil, wrapError(ctx, phaseChallenge, err)
+	}
+
+	issued, err := parseChallenge(message)
 	if err != nil {
 		c.logger.Error("Failed to receive challenge", zap.Error(err))
 
-		return err
+		return nil, wrapError(ctx, phaseChallenge, err)
+	}
+	challenge, difficulty := issued.challenge, issued.difficulty
+
+	// A hostile server could otherwise keep the client grinding forever
+	if difficulty > c.config.MaxDifficulty {
+		err := fmt.Errorf("difficulty %d above max_difficulty %d", difficulty, c.config.MaxDifficulty)
+		c.logger.Error("Refusing challenge", zap.Error(err))
+
+		return nil, wrapError(ctx, phaseChallenge, err)
 	}
 
 	c.logger.Info("Challenge received",
 		zap.String("challenge", challenge),
-		zap.Time("serverTimestamp", serverTimestamp),
+		zap.Time("serverTimestamp", issued.timestamp),
 		zap.Int("difficulty", difficulty),
+		zap.String("purpose", issued.purpose),
 	)
 
 	// Solve PoW challenge
-	nonce, err := c.solvePoW(ctx, challenge, serverTimestamp, difficulty)
+	solveStart := time.Now()
+	stopKeepAlive := c.startKeepAlive(conn)
+	nonce, attempts, err := c.solvePoW(ctx, challenge, issued.timestamp, issued.purpose, issued.nonceEncoding, difficulty)
+	stopKeepAlive()
 	if err != nil {
 		c.logger.Error("Failed to solve PoW", zap.Error(err))
 
-		return err
+		return nil, wrapError(ctx, phaseSolve, err)
 	}
+	solveTime := time.Since(solveStart)
 
-	c.logger.Info("PoW solved", zap.String("nonce", nonce))
+	c.logger.Info("PoW solved", zap.String("nonce", nonce), zap.Int("attempts", attempts), zap.Duration("solve_time", solveTime))
 
 	// Send solution to server
 	clientTimestamp := time.Now().UTC()
-	if err := c.sendResponse(conn, nonce, clientTimestamp); err != nil {
+	if err := c.sendResponse(conn, issued, nonce, clientTimestamp, attempts, request); err != nil {
 		c.logger.Error("Failed to send response", zap.Error(err))
 
-		return err
+		return nil, wrapError(ctx, phaseRespond, err)
+	}
+
+	// A server gone silent after the solution is given up on early
+	if c.config.ResponseTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(c.config.ResponseTimeout)); err != nil {
+			c.logger.Warn("set read deadline failed", zap.Error(err))
+		}
 	}
 
 	// Receive server response (quote or error)
-	if err := c.receiveServerResponse(conn); err != nil {
+	quote, err := c.receiveServerResponse(reader)
+	if errors.Is(err, os.ErrDeadlineExceeded) && c.config.ResponseTimeout > 0 && ctx.Err() == nil {
+		err = fmt.Errorf("no response within response_timeout %s: %w", c.config.ResponseTimeout, err)
+	}
+	if err != nil {
 		c.logger.Error("Failed to receive server response", zap.Error(err))
 
-		return err
+		return nil, wrapError(ctx, phaseReceive, err)
 	}
 
-	return nil
+	return &Result{
+		Challenge:  challenge,
+		Difficulty: difficulty,
+		Nonce:      nonce,
+		Attempts:   attempts,
+		SolveTime:  solveTime,
+		Quote:      quote,
+	}, nil
 }
 
-// receiveChallenge reads the challenge message from the server
-func (c *WordOfWisdomClient) receiveChallenge(conn net.Conn) (string, time.Time, int, error) {
-	buffer := make([]byte, 4096)
-	n, err := conn.Read(buffer)
-	if err != nil {
-		return "", time.Time{}, 0, err
-	}
+// followUp is what the client asks the server for after a quote
+type followUp string
+
+const (
+	followNone followUp = ""
+	// followNext asks for the next challenge
+	followNext followUp = "Next:1"
+	// followSubscribe asks for quotes pushed at the server's interval
+	followSubscribe followUp = "Subscribe:1"
+)
+
+// challengeMessage is a challenge issued by the server
+type challengeMessage struct {
+	challenge  string
+	timestamp  time.Time
+	difficulty int
+	// purpose binds the challenge to a use, it is empty for unbound challenges
+	purpose string
+	// nonceEncoding is how the server wants the nonce written
+	nonceEncoding pow.NonceEncoding
+}
 
-	message := strings.TrimSpace(string(buffer[:n]))
-	parts := strings.Split(message, ";")
-	if len(parts) != 3 {
-		return "", time.Time{}, 0, fmt.Errorf("invalid challenge format")
+// parseChallenge parses the challenge message from the server
+func parseChallenge(message string) (challengeMessage, error) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(message, ";") {
+		key, value, ok := strings.Cut(part, ":")
+		if !ok {
+			return challengeMessage{}, fmt.Errorf("invalid challenge format")
+		}
+		fields[key] = value
 	}
 
-	challenge := strings.TrimPrefix(parts[0], "Challenge:")
-	timestampStr := strings.TrimPrefix(parts[1], "Timestamp:")
-	difficultyStr := strings.TrimPrefix(parts[2], "Difficulty:")
+	challenge, hasChallenge := fields["Challenge"]
+	timestampStr, hasTimestamp := fields["Timestamp"]
+	difficultyStr, hasDifficulty := fields["Difficulty"]
+	if !hasChallenge || !hasTimestamp || !hasDifficulty {
+		return challengeMessage{}, fmt.Errorf("invalid challenge format")
+	}
 
 	serverTimestamp, err := time.Parse(time.RFC3339Nano, timestampStr)
 	if err != nil {
-		return "", time.Time{}, 0, fmt.Errorf("invalid timestamp format: %w", err)
+		return challengeMessage{}, fmt.Errorf("invalid timestamp format: %w", err)
 	}
 
 	difficulty, err := strconv.Atoi(difficultyStr)
 	if err != nil {
-		return "", time.Time{}, 0, fmt.Errorf("invalid difficulty value: %w", err)
+		return challengeMessage{}, fmt.Errorf("invalid difficulty value: %w", err)
 	}
 
-	return challenge, serverTimestamp, difficulty, nil
-}
-
-// solvePoW solves the Proof of Work challenge
-func (c *WordOfWisdomClient) solvePoW(ctx context.Context, challenge string, serverTimestamp time.Time, difficulty int) (string, error) {
-	var nonce int
-	requiredPrefix := strings.Repeat("0", difficulty)
+	// Refuse nonsensical difficulties before they size any allocation
+	if difficulty < 0 || difficulty > pow.MaxDifficulty {
+		return challengeMessage{}, fmt.Errorf("difficulty %d out of range [0, %d]", difficulty, pow.MaxDifficulty)
+	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return "", ctx.Err()
-		default:
-			data := fmt.Sprintf("%s%d%s", challenge, nonce, serverTimestamp.Format(time.RFC3339Nano))
+	nonceEncoding := pow.NonceEncoding(fields["NonceEncoding"])
+	if !nonceEncoding.Valid() {
+		return challengeMessage{}, fmt.Errorf("unknown nonce encoding %q", nonceEncoding)
+	}
 
-			hash := sha256.Sum256([]byte(data))
-			hashHex := hex.EncodeToString(hash[:])
+	return challengeMessage{
+		challenge:     challenge,
+		timestamp:     serverTimestamp,
+		difficulty:    difficulty,
+		purpose:       fields["Purpose"],
+		nonceEncoding: nonceEncoding,
+	}, nil
+}
 
-			if strings.HasPrefix(hashHex, requiredPrefix) {
-				return strconv.Itoa(nonce), nil
-			}
+// solvePoW solves the Proof of Work challenge, returning the nonce in the
+// given encoding and the number of hashes computed to find it
+func (c *WordOfWisdomClient) solvePoW(ctx context.Context, challenge string, serverTimestamp time.Time, purpose string, encoding pow.NonceEncoding, difficulty int) (string, int, error) {
+	// No solution exists outside the range, don't search forever
+	if difficulty < 0 || difficulty > pow.MaxDifficulty {
+		return "", 0, fmt.Errorf("difficulty %d out of range [0, %d]", difficulty, pow.MaxDifficulty)
+	}
 
-			nonce++
-		}
+	if c.config.DeterministicNonceStart {
+		return solveSequential(ctx, c.layout, challenge, serverTimestamp, purpose, c.config.HashTimestampFormat, encoding, difficulty)
 	}
+
+	return solveParallel(ctx, c.solvers, c.layout, challenge, serverTimestamp, purpose, c.config.HashTimestampFormat, encoding, difficulty)
 }
 
-// sendResponse transmits the nonce and client timestamp to the server
-func (c *WordOfWisdomClient) sendResponse(conn net.Conn, nonce string, timestamp time.Time) error {
-	message := fmt.Sprintf("Nonce:%s;Timestamp:%s\n", nonce, timestamp.Format(time.RFC3339Nano))
+// sendResponse transmits the nonce, client timestamp and number of attempts to
+// the server, echoing the challenge the solution is for and its purpose, and
+// asks for more after the quote as given by request
+func (c *WordOfWisdomClient) sendResponse(conn net.Conn, issued challengeMessage, nonce string, timestamp time.Time, attempts int, request followUp) error {
+	message := fmt.Sprintf("Nonce:%s;Timestamp:%s;Attempts:%d;Challenge:%s",
+		nonce, timestamp.Format(time.RFC3339Nano), attempts, issued.challenge)
+	if issued.purpose != "" {
+		message += ";Purpose:" + issued.purpose
+	}
+	if c.config.Software != "" {
+		message += ";Client:" + c.config.Software
+	}
+	if request != followNone {
+		message += ";" + string(request)
+	}
+	message += "\n"
 	_, err := conn.Write([]byte(message))
 
 	return err
 }
 
-// receiveServerResponse reads the server's response (quote or error)
-func (c *WordOfWisdomClient) receiveServerResponse(conn net.Conn) error {
-	buffer := make([]byte, 4096)
-	n, err := conn.Read(buffer)
+// receiveServerResponse reads the server's response and returns the quote, or
+// a *ServerError when the server responded with an error
+func (c *WordOfWisdomClient) receiveServerResponse(reader *bufio.Reader) (string, error) {
+	response, err := readMessage(reader, c.config.MaxMessageBytes)
+	for err == nil && response == pongMessage {
+		response, err = readMessage(reader, c.config.MaxMessageBytes)
+	}
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	response := strings.TrimSpace(string(buffer[:n]))
-	if strings.HasPrefix(response, "Quote:") {
-		quote := strings.TrimPrefix(response, "Quote:")
+	if quote, ok := strings.CutPrefix(response, "Quote:"); ok {
 		c.logger.Info("Received quote", zap.String("quote", quote))
-	} else if strings.HasPrefix(response, "Error:") {
-		errorMessage := strings.TrimPrefix(response, "Error:")
-		c.logger.Warn("Received error from server", zap.String("error", errorMessage))
-	} else {
-		c.logger.Warn("Unknown server response", zap.String("response", response))
+
+		return quote, nil
 	}
+	if payload, ok := strings.CutPrefix(response, "Error:"); ok {
+		err := newServerError(payload)
+		c.logger.Warn("Received error from server", zap.Error(err))
 
-	return nil
+		return "", err
+	}
+
+	return "", fmt.Errorf("unknown server response %q", response)
+}
+
+// newServerError parses the payload of an Error message
+func newServerError(payload string) *ServerError {
+	code, message := protocol.ParseError(payload)
+
+	return &ServerError{Code: code, Message: message}
+}
+
+// readMessage reads a newline-terminated message of at most limit bytes,
+// reassembling it from several reads when it doesn't fit the reader's buffer
+func readMessage(reader *bufio.Reader, limit int) (string, error) {
+	var message []byte
+	for {
+		line, err := reader.ReadSlice('\n')
+		if len(message)+len(line) > limit {
+			return "", fmt.Errorf("message exceeds %d bytes", limit)
+		}
+		message = append(message, line...)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(message)), nil
+	}
+}
+
+// peekLine returns the next newline-terminated line, including the newline,
+// without consuming it
+func peekLine(reader *bufio.Reader) (string, error) {
+	for {
+		buffered, _ := reader.Peek(reader.Buffered())
+		if i := bytes.IndexByte(buffered, '\n'); i >= 0 {
+			return string(buffered[:i+1]), nil
+		}
+
+		_, err := reader.Peek(reader.Buffered() + 1)
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return "", fmt.Errorf("message exceeds %d bytes", reader.Size())
+		}
+		if err != nil {
+			return "", err
+		}
+	}
 }
 
 // main entry point of the client application
 func main() {
-	logger, err := zap.NewProduction()
+	output := flag.String("output", outputText, "output format of a single exchange: text logs or a json object on stdout")
+	benchmark := flag.String("benchmark", "", "solve random challenges offline for a difficulty range like 1-6 and print the median solve times")
+	benchmarkRuns := flag.Int("benchmark-runs", 5, "challenges solved per difficulty in benchmark mode")
+	stress := flag.Float64("stress", 0, "double the concurrency until this share of requests fails, e.g. 0.05, and print the breaking point")
+	stressMaxConcurrency := flag.Int("stress-max-concurrency", 256, "highest concurrency tried in stress mode")
+	stressRequests := flag.Int("stress-requests", 4, "requests per concurrent worker at every stress level")
+	solveFile := flag.String("solve-file", "", "solve the challenges in this JSON lines file offline, without connecting to a server")
+	solveOutput := flag.String("solve-output", "solutions.jsonl", "file the solutions of -solve-file are appended to")
+	flag.Parse()
+
+	// In JSON mode only problems are logged, keeping the output to the result
+	logConfig := zap.NewProductionConfig()
+	if *output == outputJSON {
+		logConfig.Level = zap.NewAtomicLevelAt(zap.WarnLevel)
+	}
+
+	logger, err := logConfig.Build()
 	if err != nil {
 		log.Fatalf("Failed to initialize zap logger: %v", err)
 	}
@@ -191,10 +534,94 @@ func main() {
 	}
 
 	client := NewClient(cfg.Client, logger)
-	ctx, cancel := context.WithTimeout(context.Background(), client.config.ConnectionTimeout)
-	defer cancel()
 
-	if err := client.Run(ctx); err != nil {
+	// Interrupting the client cancels it, as opposed to running out of time
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *benchmark != "" {
+		var minDifficulty, maxDifficulty int
+		if _, err := fmt.Sscanf(*benchmark, "%d-%d", &minDifficulty, &maxDifficulty); err != nil {
+			logger.Fatal("Invalid benchmark difficulty range, want e.g. 1-6", zap.String("benchmark", *benchmark))
+		}
+
+		results, err := client.Benchmark(ctx, minDifficulty, maxDifficulty, *benchmarkRuns)
+		if err != nil {
+			logger.Fatal("Benchmark failed", zap.Error(err))
+		}
+		if err := writeBenchmark(os.Stdout, results); err != nil {
+			logger.Fatal("Failed to write benchmark", zap.Error(err))
+		}
+
+		return
+	}
+
+	if *solveFile != "" {
+		solved, err := client.SolveFile(ctx, *solveFile, *solveOutput)
+		if err != nil {
+			logger.Fatal("Offline solving failed", zap.Int("solved", solved), zap.Error(err))
+		}
+		logger.Info("Challenges solved offline", zap.Int("solved", solved), zap.String("output", *solveOutput))
+
+		return
+	}
+
+	if *stress > 0 {
+		levels, err := client.Stress(ctx, *stress, *stressMaxConcurrency, *stressRequests)
+		if err != nil {
+			logger.Fatal("Stress test failed", zap.Error(err))
+		}
+		if err := writeStress(os.Stdout, levels, *stress); err != nil {
+			logger.Fatal("Failed to write stress results", zap.Error(err))
+		}
+
+		return
+	}
+
+	if cfg.Client.Subscribe {
+		received, err := client.Subscribe(ctx)
+		if err != nil {
+			logger.Fatal("Client encountered an error", zap.Error(err))
+		}
+		logger.Info("Subscription finished", zap.Int("quotes", received))
+
+		return
+	}
+
+	if cfg.Client.ChainedRequests > 1 {
+		results, err := client.RunChained(ctx, cfg.Client.ChainedRequests)
+		if err != nil {
+			logger.Fatal("Client encountered an error", zap.Error(err))
+		}
+		logger.Info("Chain finished", zap.Int("quotes", len(results)))
+
+		return
+	}
+
+	if cfg.Client.Requests > 1 {
+		batch := client.RunN(ctx, cfg.Client.Requests, cfg.Client.Concurrency)
+		logger.Info("Batch finished", zap.Int("succeeded", batch.Succeeded), zap.Int("failed", batch.Failed))
+
+		if batch.SolveTimes != nil {
+			logger.Info("Solve time percentiles",
+				zap.Int("samples", batch.SolveTimes.Count()),
+				zap.Duration("p50", batch.SolveTimes.Percentile(50)),
+				zap.Duration("p90", batch.SolveTimes.Percentile(90)),
+				zap.Duration("p99", batch.SolveTimes.Percentile(99)),
+			)
+		}
+
+		return
+	}
+
+	result, err := client.RunWithRetry(ctx)
+	if err != nil {
 		logger.Fatal("Client encountered an error", zap.Error(err))
 	}
+
+	if *output == outputJSON {
+		if err := writeJSONResult(os.Stdout, result); err != nil {
+			logger.Fatal("Failed to write result", zap.Error(err))
+		}
+	}
 }
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/loopback"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"go.uber.org/zap"
+)
+
+// testClientConfig is a minimal valid client configuration for tests
+func testClientConfig() config.ClientConfig {
+	return config.ClientConfig{
+		ConnectionTimeout: time.Minute,
+		MaxNonce:          1_000_000_000,
+		Requests:          1,
+		Concurrency:       1,
+		ReadBufferBytes:   4096,
+		SolverWorkers:     2,
+	}
+}
+
+// serveScripted accepts a connection per answer on listener, issues a
+// challenge on each and answers the solution with the next answer. Whether
+// each solution verified is sent on the returned channel
+func serveScripted(t *testing.T, listener *loopback.Listener, answers ...string) <-chan bool {
+	t.Helper()
+
+	return serveScriptedChunks(t, listener, 0, answers...)
+}
+
+// serveScriptedChunks is serveScripted writing the answers in chunks of at
+// most chunkBytes bytes, or at once when it is 0
+func serveScriptedChunks(t *testing.T, listener *loopback.Listener, chunkBytes int, answers ...string) <-chan bool {
+	t.Helper()
+
+	verified := make(chan bool, len(answers))
+	go func() {
+		for _, answer := range answers {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			timestamp := time.Now().UTC()
+			_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + timestamp.Format(time.RFC3339Nano) + ";Difficulty:2\n"))
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			if err != nil {
+				verified <- false
+				_ = conn.Close()
+
+				continue
+			}
+			nonce, _, _ := strings.Cut(strings.TrimPrefix(line, "Nonce:"), ";")
+			sum := pow.Sum("abc", nonce, timestamp, "", "")
+			verified <- strings.HasPrefix(hex.EncodeToString(sum[:]), "00")
+			message := []byte(answer + "\n")
+			for len(message) > 0 {
+				chunk := message
+				if chunkBytes > 0 {
+					chunk = message[:min(chunkBytes, len(message))]
+				}
+				_, _ = conn.Write(chunk)
+				message = message[len(chunk):]
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	return verified
+}
+
+func TestUseDialer(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+	verified := serveScripted(t, listener, "Quote:Over loopback")
+
+	c := NewClient(testClientConfig(), zap.NewNop())
+	c.UseDialer(listener.Dial)
+
+	result, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !<-verified {
+		t.Error("server got no valid solution")
+	}
+	if result.Quote != "Over loopback" {
+		t.Errorf("quote %q, want %q", result.Quote, "Over loopback")
+	}
+}
+
+func TestReassemblesChunkedQuote(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	// A quote many times the read buffer, streamed in small chunks
+	cfg := testClientConfig()
+	cfg.ReadBufferBytes = config.MinReadBufferBytes
+	quote := strings.Repeat("Know thyself. ", 1000)
+	verified := serveScriptedChunks(t, listener, 100, "Quote:"+quote)
+
+	c := NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+	result, err := c.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !<-verified {
+		t.Error("server got no valid solution")
+	}
+	if result.Quote != strings.TrimSpace(quote) {
+		t.Errorf("quote of %d bytes, want the %d bytes sent", len(result.Quote), len(strings.TrimSpace(quote)))
+	}
+
+	// Messages past the limit are still refused
+	cfg.MaxMessageBytes = 1000
+	serveScriptedChunks(t, listener, 100, "Quote:"+quote)
+	c = NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+	if _, err := c.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "message exceeds 1000 bytes") {
+		t.Errorf("quote past max_message_bytes: %v, want it refused", err)
+	}
+}
+
+func TestRefusesChallengeAboveMaxDifficulty(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	// A difficulty the server could never expect anyone to solve
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + time.Now().UTC().Format(time.RFC3339Nano) + ";Difficulty:20\n"))
+		_, _ = bufio.NewReader(conn).ReadString('\n')
+	}()
+
+	c := NewClient(testClientConfig(), zap.NewNop())
+	c.UseDialer(listener.Dial)
+
+	start := time.Now()
+	_, err := c.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "above max_difficulty 8") {
+		t.Fatalf("difficulty 20: %v, want it refused", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("refusing took %v, the client tried solving", elapsed)
+	}
+}
+
+func TestParseChallengeRejectsNonsensicalDifficulty(t *testing.T) {
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	for _, difficulty := range []string{"-1", strconv.Itoa(pow.MaxDifficulty + 1), "9223372036854775807"} {
+		_, err := parseChallenge("Challenge:abc;Timestamp:" + timestamp + ";Difficulty:" + difficulty)
+		if err == nil {
+			t.Errorf("difficulty %s parsed, want it refused", difficulty)
+		}
+	}
+}
+
+func TestDeterministicNonceStartRepeatsNonce(t *testing.T) {
+	cfg := testClientConfig()
+	cfg.DeterministicNonceStart = true
+	timestamp := time.Now().UTC()
+
+	var nonces []string
+	for range 3 {
+		c := NewClient(cfg, zap.NewNop())
+		nonce, attempts, err := c.solvePoW(context.Background(), "abc", timestamp, "", pow.NonceDecimal, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := pow.Sum("abc", nonce, timestamp, "", "")
+		if !strings.HasPrefix(hex.EncodeToString(sum[:]), "000") {
+			t.Fatalf("nonce %s doesn't solve the challenge", nonce)
+		}
+		// Searched from 0, the nonce is the number of hashes before it
+		if want := strconv.Itoa(attempts - 1); nonce != want {
+			t.Errorf("nonce %s after %d attempts, want %s", nonce, attempts, want)
+		}
+		nonces = append(nonces, nonce)
+	}
+
+	if nonces[1] != nonces[0] || nonces[2] != nonces[0] {
+		t.Errorf("runs found nonces %v, want the same one", nonces)
+	}
+}
+
+func TestSolvesNonCanonicalTimestamp(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	// The issued instant, spelled with an offset and trailing zeros
+	timestamp := time.Now().Truncate(time.Millisecond)
+	spelled := timestamp.In(time.FixedZone("", 2*60*60)).Format("2006-01-02T15:04:05.000000000Z07:00")
+	verified := make(chan bool, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + spelled + ";Difficulty:2\n"))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			verified <- false
+
+			return
+		}
+		nonce, _, _ := strings.Cut(strings.TrimPrefix(line, "Nonce:"), ";")
+		sum := pow.Sum("abc", nonce, timestamp, "", "")
+		verified <- strings.HasPrefix(hex.EncodeToString(sum[:]), "00")
+		_, _ = conn.Write([]byte("Quote:Same instant\n"))
+	}()
+
+	c := NewClient(testClientConfig(), zap.NewNop())
+	c.UseDialer(listener.Dial)
+	if _, err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !<-verified {
+		t.Errorf("solution for %s doesn't verify against the canonical timestamp", spelled)
+	}
+}
+
+func TestBannerOptional(t *testing.T) {
+	for _, tc := range []struct {
+		banner, expected string
+		ok               bool
+	}{
+		{banner: "WOW-PoW/1", ok: true},
+		{banner: "", ok: true},
+		{banner: "WOW-PoW/1", expected: "WOW-PoW/1", ok: true},
+		{banner: "", expected: "WOW-PoW/1", ok: false},
+		{banner: "SSH-2.0", expected: "WOW-PoW/1", ok: false},
+	} {
+		listener := loopback.NewListener()
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+
+			if tc.banner != "" {
+				_, _ = conn.Write([]byte(tc.banner + "\n"))
+			}
+			_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + time.Now().UTC().Format(time.RFC3339Nano) + ";Difficulty:1\n"))
+			if _, err := bufio.NewReader(conn).ReadString('\n'); err == nil {
+				_, _ = conn.Write([]byte("Quote:Hello\n"))
+			}
+		}()
+
+		cfg := testClientConfig()
+		cfg.ExpectedBanner = tc.expected
+		c := NewClient(cfg, zap.NewNop())
+		c.UseDialer(listener.Dial)
+		_, err := c.Run(context.Background())
+		if tc.ok && err != nil {
+			t.Errorf("banner %q, expecting %q: %v", tc.banner, tc.expected, err)
+		} else if !tc.ok && err == nil {
+			t.Errorf("banner %q accepted while expecting %q", tc.banner, tc.expected)
+		}
+		_ = listener.Close()
+	}
+}
+
+func TestSolvesWithEpochNanosTimestamp(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	timestamp := time.Now().UTC()
+	verified := make(chan bool, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + timestamp.Format(time.RFC3339Nano) + ";Difficulty:2\n"))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			verified <- false
+
+			return
+		}
+		nonce, _, _ := strings.Cut(strings.TrimPrefix(line, "Nonce:"), ";")
+		verified <- pow.HasLeadingZeros(pow.Sum("abc", nonce, timestamp, "", pow.TimestampEpochNanos), 2)
+		_, _ = conn.Write([]byte("Quote:Epoch\n"))
+	}()
+
+	cfg := testClientConfig()
+	cfg.HashTimestampFormat = pow.TimestampEpochNanos
+	c := NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+	if _, err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !<-verified {
+		t.Error("solution doesn't verify hashing the timestamp as epoch nanoseconds")
+	}
+}
+
+func TestResponseTimeoutGivesUpOnSilentServer(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	// The solution is read, but never answered
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + time.Now().UTC().Format(time.RFC3339Nano) + ";Difficulty:1\n"))
+		_, _ = io.Copy(io.Discard, conn)
+	}()
+
+	cfg := testClientConfig()
+	cfg.ResponseTimeout = 100 * time.Millisecond
+	c := NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+
+	start := time.Now()
+	_, err := c.Run(context.Background())
+	elapsed := time.Since(start)
+	if !errors.Is(err, ErrDeadlineExceeded) || !strings.Contains(err.Error(), "response_timeout") {
+		t.Fatalf("got %v, want the response_timeout reported", err)
+	}
+	if elapsed > 5*time.Second {
+		t.Errorf("gave up after %s, want about %s rather than the %s deadline", elapsed, cfg.ResponseTimeout, cfg.ConnectionTimeout)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// srvResolver resolves DNS SRV records, it is satisfied by *net.Resolver
+type srvResolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// dialSRV resolves SRVRecord and connects to its targets in order of
+// priority, picking among equal priorities by weight, until one succeeds
+func (c *WordOfWisdomClient) dialSRV(ctx context.Context) (net.Conn, error) {
+	_, targets, err := c.resolver.LookupSRV(ctx, "", "", c.config.SRVRecord)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", c.config.SRVRecord, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets in %s", c.config.SRVRecord)
+	}
+
+	var d net.Dialer
+	var errs []error
+	for _, target := range orderSRV(targets) {
+		address := net.JoinHostPort(strings.TrimSuffix(target.Target, "."), strconv.Itoa(int(target.Port)))
+
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err == nil {
+			return conn, nil
+		}
+
+		c.logger.Warn("Failed to connect to SRV target", zap.String("address", address), zap.Error(err))
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// orderSRV returns the targets in the order RFC 2782 has them tried: by
+// ascending priority, and among equal priorities in a random order in which
+// each target comes next with a likelihood proportional to its weight
+func orderSRV(targets []*net.SRV) []*net.SRV {
+	remaining := slices.Clone(targets)
+	slices.SortStableFunc(remaining, func(a, b *net.SRV) int {
+		// Zero-weight targets go first within a priority, as the RFC has it,
+		// so that they are picked only when the random sum is zero
+		if a.Priority != b.Priority {
+			return int(a.Priority) - int(b.Priority)
+		}
+
+		return min(int(a.Weight), 1) - min(int(b.Weight), 1)
+	})
+
+	ordered := make([]*net.SRV, 0, len(remaining))
+	for len(remaining) > 0 {
+		// The targets sharing the lowest remaining priority
+		end := 1
+		total := int(remaining[0].Weight)
+		for end < len(remaining) && remaining[end].Priority == remaining[0].Priority {
+			total += int(remaining[end].Weight)
+			end++
+		}
+
+		// Pick the first target whose running weight sum reaches a random
+		// number in [0, total]
+		n := rand.IntN(total + 1)
+		pick, sum := 0, int(remaining[0].Weight)
+		for sum < n {
+			pick++
+			sum += int(remaining[pick].Weight)
+		}
+
+		ordered = append(ordered, remaining[pick])
+		remaining = slices.Delete(remaining, pick, pick+1)
+	}
+
+	return ordered
+}
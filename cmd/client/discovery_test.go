@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// staticResolver resolves every SRV record to its targets, in the given order
+type staticResolver []*net.SRV
+
+// LookupSRV returns the targets
+func (r staticResolver) LookupSRV(context.Context, string, string, string) (string, []*net.SRV, error) {
+	return "", r, nil
+}
+
+// srvTarget is the SRV record of a listener
+func srvTarget(t *testing.T, listener net.Listener, priority, weight uint16) *net.SRV {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &net.SRV{Target: host + ".", Port: uint16(p), Priority: priority, Weight: weight}
+}
+
+func TestOrderSRVByPriority(t *testing.T) {
+	targets := []*net.SRV{
+		{Target: "c", Priority: 30, Weight: 5},
+		{Target: "a", Priority: 10, Weight: 0},
+		{Target: "b", Priority: 20, Weight: 1},
+		{Target: "a", Priority: 10, Weight: 7},
+	}
+
+	for range 100 {
+		ordered := orderSRV(targets)
+		if len(ordered) != len(targets) {
+			t.Fatalf("got %d targets, want %d", len(ordered), len(targets))
+		}
+		for i := 1; i < len(ordered); i++ {
+			if ordered[i].Priority < ordered[i-1].Priority {
+				t.Fatalf("priority %d tried after %d", ordered[i].Priority, ordered[i-1].Priority)
+			}
+		}
+	}
+}
+
+func TestOrderSRVByWeight(t *testing.T) {
+	light := &net.SRV{Target: "light", Priority: 10, Weight: 1}
+	heavy := &net.SRV{Target: "heavy", Priority: 10, Weight: 9}
+	unweighted := &net.SRV{Target: "unweighted", Priority: 10, Weight: 0}
+
+	const runs = 10000
+	first := make(map[string]int)
+	for range runs {
+		first[orderSRV([]*net.SRV{light, heavy, unweighted})[0].Target]++
+	}
+
+	// The random sum is drawn from [0, 10]: the unweighted target comes
+	// first only when it is zero, the heavy one in 9 of the 11 cases
+	if share := float64(first["heavy"]) / runs; share < 0.77 || share > 0.87 {
+		t.Errorf("heavy target first in %.2f of the runs, want about 9/11 of them", share)
+	}
+	if share := float64(first["unweighted"]) / runs; share > 0.15 {
+		t.Errorf("unweighted target first in %.2f of the runs, want about 1/11 of them", share)
+	}
+}
+
+func TestDialSRVFollowsPriority(t *testing.T) {
+	preferred, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = preferred.Close()
+	}()
+	backup, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = backup.Close()
+	}()
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downTarget := srvTarget(t, down, 1, 10)
+	_ = down.Close()
+
+	cfg := testClientConfig()
+	cfg.SRVRecord = "_wow._tcp.example.com"
+	c := NewClient(cfg, zap.NewNop())
+
+	// Listed backwards, the targets are still tried by priority
+	c.resolver = staticResolver{srvTarget(t, backup, 20, 10), srvTarget(t, preferred, 10, 10), downTarget}
+	accepted := acceptOne(preferred)
+	conn, err := c.dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if !<-accepted {
+		t.Error("the lowest priority target wasn't dialed")
+	}
+
+	// Targets that can't be reached are skipped
+	c.resolver = staticResolver{srvTarget(t, backup, 20, 10), downTarget}
+	accepted = acceptOne(backup)
+	conn, err = c.dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if !<-accepted {
+		t.Error("the backup target wasn't dialed after the first one failed")
+	}
+}
+
+// acceptOne reports whether listener accepts a connection within a second
+func acceptOne(listener net.Listener) <-chan bool {
+	accepted := make(chan bool, 1)
+	go func() {
+		_ = listener.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second))
+		conn, err := listener.Accept()
+		if err == nil {
+			_ = conn.Close()
+		}
+		accepted <- err == nil
+	}()
+
+	return accepted
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/protocol"
+)
+
+// Phases of an exchange with the server, reported by ClientError
+const (
+	phaseConnect   = "connect"
+	phaseChallenge = "receive challenge"
+	phaseSolve     = "solve"
+	phaseRespond   = "send response"
+	phaseReceive   = "receive response"
+)
+
+var (
+	// ErrCanceled is reported when the exchange was canceled by the caller,
+	// it should not be retried
+	ErrCanceled = errors.New("exchange canceled")
+	// ErrDeadlineExceeded is reported when the exchange ran out of time, a
+	// new attempt may succeed
+	ErrDeadlineExceeded = errors.New("exchange deadline exceeded")
+)
+
+// ClientError is an error from a phase of an exchange with the server
+type ClientError struct {
+	Phase string
+	Err   error
+}
+
+// Error returns the error message prefixed by the failed phase
+func (e *ClientError) Error() string {
+	return e.Phase + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *ClientError) Unwrap() error {
+	return e.Err
+}
+
+// ServerError is an error reported by the server with one of the protocol
+// error codes, the code is empty for servers that don't send one
+type ServerError struct {
+	Code    string
+	Message string
+}
+
+// Error returns the code and message reported by the server
+func (e *ServerError) Error() string {
+	if e.Code == "" {
+		return "server error: " + e.Message
+	}
+
+	return "server error " + e.Code + ": " + e.Message
+}
+
+// wrapError turns an error from the given phase into a *ClientError. Context
+// cancellation and deadline expiry, whether observed through ctx or through
+// the connection's deadline, are reported as ErrCanceled and ErrDeadlineExceeded
+func wrapError(ctx context.Context, phase string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		err = fmt.Errorf("%w: %w", ErrCanceled, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded):
+		err = fmt.Errorf("%w: %w", ErrDeadlineExceeded, err)
+	}
+
+	return &ClientError{Phase: phase, Err: err}
+}
+
+// retryable reports whether an exchange that failed with err is worth
+// retrying; solutions the server rejected as invalid would fail again
+func retryable(err error) bool {
+	if errors.Is(err, ErrCanceled) {
+		return false
+	}
+
+	var serverErr *ServerError
+	if errors.As(err, &serverErr) {
+		switch serverErr.Code {
+		case protocol.CodeBadPoW, protocol.CodeMalformed, protocol.CodeMismatch, protocol.CodeReused:
+			return false
+		}
+	}
+
+	return true
+}
+
+// expired reports whether the server rejected a solution only for coming too
+// late, in which case a new attempt is made without backing off
+func expired(err error) bool {
+	var serverErr *ServerError
+
+	return errors.As(err, &serverErr) && serverErr.Code == protocol.CodeExpired
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// histogramBuckets is the number of histogram buckets; bucket i holds
+	// samples up to histogramBase*2^i, the last one holds everything above
+	histogramBuckets = 32
+	histogramBase    = 100 * time.Microsecond
+)
+
+// solveTimeHistogram is a bucketed histogram of solve times
+type solveTimeHistogram struct {
+	mu     sync.Mutex
+	counts [histogramBuckets]int
+	total  int
+}
+
+// Observe records a solve time
+func (h *solveTimeHistogram) Observe(d time.Duration) {
+	i := 0
+	for i < histogramBuckets-1 && d > bucketBound(i) {
+		i++
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[i]++
+	h.total++
+}
+
+// Count returns the number of recorded solve times
+func (h *solveTimeHistogram) Count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.total
+}
+
+// Percentile returns the upper bound of the bucket holding the p-th
+// percentile (0 < p <= 100), or 0 when nothing was recorded
+func (h *solveTimeHistogram) Percentile(p float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.total == 0 {
+		return 0
+	}
+
+	rank := int(math.Ceil(p / 100 * float64(h.total)))
+	seen := 0
+	for i, count := range h.counts {
+		seen += count
+		if seen >= rank {
+			return bucketBound(i)
+		}
+	}
+
+	return bucketBound(histogramBuckets - 1)
+}
+
+// bucketBound returns the upper bound of bucket i
+func bucketBound(i int) time.Duration {
+	return histogramBase << i
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSolveTimeHistogramPercentiles(t *testing.T) {
+	var h solveTimeHistogram
+	if p := h.Percentile(50); p != 0 {
+		t.Errorf("empty histogram p50 %s, want 0", p)
+	}
+
+	// 90 fast solves, 9 slower ones and one outlier
+	for range 90 {
+		h.Observe(50 * time.Microsecond)
+	}
+	for range 9 {
+		h.Observe(3 * time.Millisecond)
+	}
+	h.Observe(time.Second)
+
+	if h.Count() != 100 {
+		t.Fatalf("count %d, want 100", h.Count())
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{50, histogramBase},
+		{90, histogramBase},
+		{91, 3200 * time.Microsecond},
+		{99, 3200 * time.Microsecond},
+		{100, 1638400 * time.Microsecond},
+	}
+	for _, tt := range tests {
+		if got := h.Percentile(tt.p); got != tt.want {
+			t.Errorf("p%g %s, want %s", tt.p, got, tt.want)
+		}
+	}
+
+	// Samples past the last bucket end up in it
+	h.Observe(1000 * time.Hour)
+	if got := h.Percentile(100); got != bucketBound(histogramBuckets-1) {
+		t.Errorf("p100 with a huge sample %s, want the last bucket", got)
+	}
+}
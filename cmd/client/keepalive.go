@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pingMessage and pongMessage are the keep-alive messages
+const (
+	pingMessage = "Ping"
+	pongMessage = "Pong"
+)
+
+// startKeepAlive sends a ping every KeepAliveInterval until the returned
+// function is called, which waits for the pings to stop so that the
+// connection is free for the response
+func (c *WordOfWisdomClient) startKeepAlive(conn net.Conn) func() {
+	if c.config.KeepAliveInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(c.config.KeepAliveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := conn.Write([]byte(pingMessage + "\n")); err != nil {
+					c.logger.Warn("Failed to send ping", zap.Error(err))
+
+					return
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/recording"
+	"go.uber.org/zap"
+)
+
+// SolveFile solves the challenges read from inputPath without connecting to
+// any server and appends the solutions to outputPath, returning how many were
+// solved. Both files hold one JSON object per line in the format of the
+// server's solution recording, the nonce of the input being ignored; a
+// challenge without a timestamp format is hashed with the configured one. The
+// output can be checked with the server's -verify-solutions
+func (c *WordOfWisdomClient) SolveFile(ctx context.Context, inputPath, outputPath string) (int, error) {
+	challenges, err := recording.Read(inputPath)
+	if err != nil {
+		return 0, err
+	}
+
+	recorder, err := recording.Open(outputPath)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = recorder.Close()
+	}()
+
+	for i, challenge := range challenges {
+		if challenge.Difficulty < 0 || challenge.Difficulty > pow.MaxDifficulty {
+			return i, fmt.Errorf("challenge %d: difficulty %d out of range [0, %d]", i+1, challenge.Difficulty, pow.MaxDifficulty)
+		}
+		if challenge.TimestampFormat == "" {
+			challenge.TimestampFormat = c.config.HashTimestampFormat
+		}
+		if !challenge.TimestampFormat.Valid() {
+			return i, fmt.Errorf("challenge %d: unknown timestamp format %q", i+1, challenge.TimestampFormat)
+		}
+
+		nonce, attempts, solveErr := solveParallel(ctx, c.solvers, c.layout, challenge.Challenge, challenge.Timestamp,
+			challenge.Purpose, challenge.TimestampFormat, pow.NonceDecimal, challenge.Difficulty)
+		if solveErr != nil {
+			return i, fmt.Errorf("challenge %d: %w", i+1, solveErr)
+		}
+
+		challenge.Nonce = nonce
+		challenge.ClientTimestamp = time.Now().UTC()
+		if err := recorder.Record(challenge); err != nil {
+			return i, err
+		}
+		c.logger.Debug("Challenge solved offline", zap.Int("line", i+1), zap.Int("attempts", attempts))
+	}
+
+	return len(challenges), nil
+}
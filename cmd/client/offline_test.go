@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/recording"
+	"go.uber.org/zap"
+)
+
+func TestSolveFile(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "challenges.jsonl")
+	output := filepath.Join(dir, "solutions.jsonl")
+	lines := `{"challenge":"first","timestamp":"2024-01-02T03:04:05.123Z","difficulty":2}
+{"challenge":"second","timestamp":"2024-01-02T03:04:06Z","difficulty":3,"purpose":"signup"}
+{"challenge":"third","timestamp":"2024-01-02T03:04:07Z","difficulty":2,"timestamp_format":"epoch_nanos"}
+`
+	if err := os.WriteFile(input, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClient(testClientConfig(), zap.NewNop())
+	solved, err := c.SolveFile(context.Background(), input, output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if solved != 3 {
+		t.Fatalf("solved %d challenges, want 3", solved)
+	}
+
+	solutions, err := recording.Read(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(solutions) != 3 {
+		t.Fatalf("wrote %d solutions, want 3", len(solutions))
+	}
+	for _, solution := range solutions {
+		if !pow.Verify(solution.Challenge, solution.Nonce, solution.Timestamp, solution.Purpose, solution.TimestampFormat, solution.Difficulty) {
+			t.Errorf("nonce %s doesn't solve %+v", solution.Nonce, solution)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Output formats of the client
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// jsonResult is the JSON form of a Result
+type jsonResult struct {
+	Quote      string  `json:"quote"`
+	Challenge  string  `json:"challenge"`
+	Difficulty int     `json:"difficulty"`
+	Nonce      string  `json:"nonce"`
+	Attempts   int     `json:"attempts"`
+	SolveTime  float64 `json:"solve_time_ms"`
+}
+
+// writeJSONResult writes the result as a single JSON object line
+func writeJSONResult(w io.Writer, result *Result) error {
+	return json.NewEncoder(w).Encode(jsonResult{
+		Quote:      result.Quote,
+		Challenge:  result.Challenge,
+		Difficulty: result.Difficulty,
+		Nonce:      result.Nonce,
+		Attempts:   result.Attempts,
+		SolveTime:  float64(result.SolveTime.Microseconds()) / 1000,
+	})
+}
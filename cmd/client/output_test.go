@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJSONResult(t *testing.T) {
+	var out bytes.Buffer
+	err := writeJSONResult(&out, &Result{
+		Challenge:  "abc",
+		Difficulty: 2,
+		Nonce:      "42",
+		Attempts:   43,
+		SolveTime:  1500 * time.Microsecond,
+		Quote:      "Know thyself",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A single line, so that the output can be piped into jq
+	if lines := strings.Count(out.String(), "\n"); lines != 1 {
+		t.Fatalf("wrote %d lines, want one: %q", lines, out.String())
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(out.Bytes(), &fields); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"quote":         "Know thyself",
+		"challenge":     "abc",
+		"difficulty":    2.0,
+		"nonce":         "42",
+		"attempts":      43.0,
+		"solve_time_ms": 1.5,
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("%s is %v, want %v", key, fields[key], value)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RunWithRetry runs an exchange, bounding every attempt by the connection
+// timeout and retrying up to MaxRetries times after RetryBackoff. Attempts
+// that ran out of time are retried while a canceled ctx stops right away;
+// solutions that expired are retried at once with a fresh challenge
+func (c *WordOfWisdomClient) RunWithRetry(ctx context.Context) (*Result, error) {
+	for attempt := 0; ; attempt++ {
+		result, err := c.runWithTimeout(ctx)
+		if err == nil {
+			return result, nil
+		}
+
+		if !retryable(err) || attempt >= c.config.MaxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		c.logger.Warn("Retrying exchange", zap.Int("attempt", attempt+1), zap.Error(err))
+
+		if expired(err) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, wrapError(ctx, phaseConnect, ctx.Err())
+		case <-time.After(c.config.RetryBackoff):
+		}
+	}
+}
+
+// runWithTimeout runs a single exchange bounded by the connection timeout
+func (c *WordOfWisdomClient) runWithTimeout(ctx context.Context) (*Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.config.ConnectionTimeout)
+	defer cancel()
+
+	return c.Run(ctx)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/loopback"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/protocol"
+	"go.uber.org/zap"
+)
+
+func TestRetryExpiredAtOnce(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+	verified := serveScripted(t, listener, "Error:EXPIRED:Invalid proof of work.", "Quote:Second time lucky")
+
+	cfg := testClientConfig()
+	cfg.MaxRetries = 1
+	// Waiting for the backoff would time the test out
+	cfg.RetryBackoff = time.Hour
+	c := NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := c.RunWithRetry(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Quote != "Second time lucky" {
+		t.Errorf("quote %q, want %q", result.Quote, "Second time lucky")
+	}
+	for range 2 {
+		if !<-verified {
+			t.Error("server got no valid solution")
+		}
+	}
+}
+
+func TestRetryExpiredGivesUp(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+	serveScripted(t, listener, "Error:EXPIRED:Invalid proof of work.", "Error:EXPIRED:Invalid proof of work.")
+
+	cfg := testClientConfig()
+	cfg.MaxRetries = 1
+	c := NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+
+	_, err := c.RunWithRetry(context.Background())
+	var serverErr *ServerError
+	if !errors.As(err, &serverErr) || serverErr.Code != protocol.CodeExpired {
+		t.Errorf("got %v, want the server's %s error", err, protocol.CodeExpired)
+	}
+}
+
+// serveSilent accepts connections on listener without ever sending a
+// challenge, reporting each accepted connection on the returned channel
+func serveSilent(t *testing.T, listener *loopback.Listener) <-chan struct{} {
+	t.Helper()
+
+	accepted := make(chan struct{}, 10)
+	go func() {
+		// The connections are held open until the listener is closed
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+		}()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+			accepted <- struct{}{}
+		}
+	}()
+
+	return accepted
+}
+
+func TestRetryDeadlineButNotCancel(t *testing.T) {
+	t.Run("deadline", func(t *testing.T) {
+		listener := loopback.NewListener()
+		defer func() {
+			_ = listener.Close()
+		}()
+		accepted := serveSilent(t, listener)
+
+		cfg := testClientConfig()
+		cfg.ConnectionTimeout = 100 * time.Millisecond
+		cfg.MaxRetries = 1
+		c := NewClient(cfg, zap.NewNop())
+		c.UseDialer(listener.Dial)
+
+		_, err := c.RunWithRetry(context.Background())
+		if !errors.Is(err, ErrDeadlineExceeded) || errors.Is(err, ErrCanceled) {
+			t.Fatalf("got %v, want ErrDeadlineExceeded", err)
+		}
+		if len(accepted) != 2 {
+			t.Errorf("%d attempts made, want the timed out one retried", len(accepted))
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		listener := loopback.NewListener()
+		defer func() {
+			_ = listener.Close()
+		}()
+		accepted := serveSilent(t, listener)
+
+		cfg := testClientConfig()
+		cfg.MaxRetries = 1
+		c := NewClient(cfg, zap.NewNop())
+		c.UseDialer(listener.Dial)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-accepted
+			cancel()
+		}()
+
+		_, err := c.RunWithRetry(ctx)
+		if !errors.Is(err, ErrCanceled) || errors.Is(err, ErrDeadlineExceeded) {
+			t.Fatalf("got %v, want ErrCanceled", err)
+		}
+		if len(accepted) != 0 {
+			t.Errorf("%d more attempts made, want the canceled one not retried", len(accepted))
+		}
+	})
+}
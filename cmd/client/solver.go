@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+)
+
+// cancelCheckInterval is how many hashes a parallel worker computes between
+// checks for cancellation
+const cancelCheckInterval = 1024
+
+// solveSequential searches nonces one by one from 0, so a given challenge
+// always yields the same nonce
+func solveSequential(ctx context.Context, layout pow.DataLayout, challenge string, serverTimestamp time.Time, purpose string, format pow.TimestampFormat, encoding pow.NonceEncoding, difficulty int) (string, int, error) {
+	var nonce uint64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return "", int(nonce), ctx.Err()
+		default:
+			candidate := encoding.Encode(nonce)
+			if pow.HasLeadingZeros(pow.SumWith(layout, challenge, candidate, serverTimestamp, format, purpose), difficulty) {
+				return candidate, int(nonce) + 1, nil
+			}
+
+			nonce++
+		}
+	}
+}
+
+// solverPool bounds the solving goroutines of all the exchanges in flight
+type solverPool struct {
+	slots chan struct{}
+}
+
+// newSolverPool creates a pool allowing size solving goroutines at once
+func newSolverPool(size int) *solverPool {
+	return &solverPool{slots: make(chan struct{}, size)}
+}
+
+// acquire waits for a free slot and then takes as many more free ones as
+// available, up to limit in total, returning the number of slots taken
+func (p *solverPool) acquire(ctx context.Context, limit int) (int, error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	taken := 1
+	for taken < limit {
+		select {
+		case p.slots <- struct{}{}:
+			taken++
+		default:
+			return taken, nil
+		}
+	}
+
+	return taken, nil
+}
+
+// release returns n slots to the pool
+func (p *solverPool) release(n int) {
+	for range n {
+		<-p.slots
+	}
+}
+
+// solveParallel searches nonces on up to one worker per CPU, as many as the
+// pool allows, from a random start, each worker taking every n-th nonce, and
+// returns the first solution found
+func solveParallel(ctx context.Context, pool *solverPool, layout pow.DataLayout, challenge string, serverTimestamp time.Time, purpose string, format pow.TimestampFormat, encoding pow.NonceEncoding, difficulty int) (string, int, error) {
+	taken, err := pool.acquire(ctx, runtime.NumCPU())
+	if err != nil {
+		return "", 0, err
+	}
+	defer pool.release(taken)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := uint64(taken)
+	start := rand.Uint64()
+
+	var (
+		wg       sync.WaitGroup
+		attempts atomic.Int64
+		once     sync.Once
+		solution string
+	)
+
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var hashed int64
+			defer func() {
+				attempts.Add(hashed)
+			}()
+
+			for nonce := start + worker; ; nonce += workers {
+				if hashed%cancelCheckInterval == 0 && ctx.Err() != nil {
+					return
+				}
+
+				candidate := encoding.Encode(nonce)
+				hashed++
+				if pow.HasLeadingZeros(pow.SumWith(layout, challenge, candidate, serverTimestamp, format, purpose), difficulty) {
+					once.Do(func() {
+						solution = candidate
+						cancel()
+					})
+
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if solution == "" {
+		return "", int(attempts.Load()), ctx.Err()
+	}
+
+	return solution, int(attempts.Load()), nil
+}
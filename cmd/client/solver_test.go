@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"go.uber.org/zap"
+)
+
+func TestSolverWorkersBoundAcrossExchanges(t *testing.T) {
+	const exchanges = 16
+	cfg := testClientConfig()
+	cfg.SolverWorkers = 2
+	c := NewClient(cfg, zap.NewNop())
+
+	// Challenges nobody solves keep every exchange solving until canceled
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	baseline := runtime.NumGoroutine()
+
+	var wg sync.WaitGroup
+	for range exchanges {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _ = c.solvePoW(ctx, "abc", time.Now(), "", pow.NonceDecimal, pow.MaxDifficulty)
+		}()
+	}
+
+	// Every exchange is a goroutine, on top of which only the workers count;
+	// a little slack is left to the runtime
+	bound := baseline + exchanges + cfg.SolverWorkers + 2
+	most := 0
+	for ctx.Err() == nil {
+		most = max(most, runtime.NumGoroutine())
+		time.Sleep(time.Millisecond)
+	}
+	wg.Wait()
+
+	if most > bound {
+		t.Errorf("%d goroutines while solving, want at most %d with %d solver workers", most, bound, cfg.SolverWorkers)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+)
+
+// StressLevel is the outcome of a batch of requests at a concurrency level
+type StressLevel struct {
+	Concurrency int
+	Succeeded   int
+	Failed      int
+}
+
+// ErrorRate returns the share of the requests that failed
+func (l StressLevel) ErrorRate() float64 {
+	total := l.Succeeded + l.Failed
+	if total == 0 {
+		return 0
+	}
+
+	return float64(l.Failed) / float64(total)
+}
+
+// Stress runs batches of requestsPerWorker requests per concurrent worker,
+// doubling the concurrency from 1 up to maxConcurrency, until the error rate
+// reaches targetErrorRate. It returns the levels run, the last one being the
+// breaking point unless maxConcurrency was reached first. Requests aren't
+// retried, so that every busy server or timeout counts
+func (c *WordOfWisdomClient) Stress(ctx context.Context, targetErrorRate float64, maxConcurrency, requestsPerWorker int) ([]StressLevel, error) {
+	if targetErrorRate <= 0 || targetErrorRate > 1 {
+		return nil, fmt.Errorf("target error rate must be in (0, 1], got %g", targetErrorRate)
+	}
+	if maxConcurrency < 1 || requestsPerWorker < 1 {
+		return nil, fmt.Errorf("max concurrency and requests per worker must be positive, got %d and %d", maxConcurrency, requestsPerWorker)
+	}
+
+	probe := *c
+	probe.config.MaxRetries = 0
+
+	var levels []StressLevel
+	for concurrency := 1; concurrency <= maxConcurrency && ctx.Err() == nil; concurrency *= 2 {
+		batch := probe.RunN(ctx, concurrency*requestsPerWorker, concurrency)
+		level := StressLevel{Concurrency: concurrency, Succeeded: batch.Succeeded, Failed: batch.Failed}
+		levels = append(levels, level)
+
+		c.logger.Info("Stress level finished", zap.Int("concurrency", concurrency), zap.Float64("error_rate", level.ErrorRate()))
+
+		if level.ErrorRate() >= targetErrorRate {
+			break
+		}
+	}
+
+	return levels, ctx.Err()
+}
+
+// writeStress writes the stress levels as a table followed by the breaking
+// point, if one was found
+func writeStress(w io.Writer, levels []StressLevel, targetErrorRate float64) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "CONCURRENCY\tSUCCEEDED\tFAILED\tERROR RATE")
+	for _, level := range levels {
+		_, _ = fmt.Fprintf(tw, "%d\t%d\t%d\t%.1f%%\n", level.Concurrency, level.Succeeded, level.Failed, 100*level.ErrorRate())
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(levels) > 0 && levels[len(levels)-1].ErrorRate() >= targetErrorRate {
+		_, err := fmt.Fprintf(w, "Breaking point: concurrency %d\n", levels[len(levels)-1].Concurrency)
+
+		return err
+	}
+	_, err := fmt.Fprintln(w, "No breaking point found")
+
+	return err
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/loopback"
+	"go.uber.org/zap"
+)
+
+// serveWithWorkers serves challenges on listener with a pool of workers,
+// turning connections away as busy while every worker is taken, the way the
+// server does once max_connections is reached
+func serveWithWorkers(listener *loopback.Listener, workers int, hold time.Duration) {
+	slots := make(chan struct{}, workers)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			_, _ = conn.Write([]byte("Error:BUSY:Server busy.\n"))
+			_ = conn.Close()
+
+			continue
+		}
+
+		go func(conn net.Conn) {
+			defer func() {
+				_ = conn.Close()
+			}()
+
+			timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+			_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + timestamp + ";Difficulty:1\n"))
+			_, err := bufio.NewReader(conn).ReadString('\n')
+			time.Sleep(hold)
+
+			// The worker is free again before the client hears back
+			<-slots
+			if err == nil {
+				_, _ = conn.Write([]byte("Quote:Hang in there\n"))
+			}
+		}(conn)
+	}
+}
+
+func TestStressFindsBreakingPoint(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+	go serveWithWorkers(listener, 2, 20*time.Millisecond)
+
+	cfg := testClientConfig()
+	// Stress doesn't retry, or busy servers would go unnoticed
+	cfg.MaxRetries = 3
+	c := NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	levels, err := c.Stress(ctx, 0.25, 64, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Up to the two workers every request is served, with four clients about
+	// half of them are turned away
+	last := levels[len(levels)-1]
+	if last.Concurrency != 4 || last.ErrorRate() < 0.25 {
+		t.Fatalf("breaking point at concurrency %d with error rate %.2f, want 4", last.Concurrency, last.ErrorRate())
+	}
+	for _, level := range levels[:len(levels)-1] {
+		if level.Failed != 0 {
+			t.Errorf("%d of %d requests failed at concurrency %d, within the worker pool",
+				level.Failed, level.Failed+level.Succeeded, level.Concurrency)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Subscribe solves a single challenge and then receives the quotes the server
+// pushes at its own interval until it ends the subscription, SubscribeDuration
+// has passed or ctx is done, returning the number of quotes received
+func (c *WordOfWisdomClient) Subscribe(ctx context.Context) (int, error) {
+	end := time.Now().Add(c.config.ConnectionTimeout + c.config.SubscribeDuration)
+	ctx, cancel := context.WithDeadline(ctx, end)
+	defer cancel()
+
+	conn, reader, closeConn, err := c.connect(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer closeConn()
+
+	if _, err := c.exchange(ctx, conn, reader, followSubscribe); err != nil {
+		return 0, err
+	}
+
+	// The server decides how often quotes come, ctx still unblocks the reads
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		c.logger.Warn("set deadline failed", zap.Error(err))
+	}
+
+	received := 1
+	for {
+		quote, err := c.receiveServerResponse(reader)
+		if errors.Is(err, io.EOF) {
+			c.logger.Info("Server ended the subscription", zap.Int("quotes", received))
+
+			return received, nil
+		}
+		// Interrupting is the usual way to end a subscription
+		if errors.Is(ctx.Err(), context.Canceled) {
+			c.logger.Info("Subscription canceled", zap.Int("quotes", received))
+
+			return received, nil
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !time.Now().Before(end) {
+			c.logger.Info("Subscription duration over", zap.Int("quotes", received))
+
+			return received, nil
+		}
+		if err != nil {
+			return received, wrapError(ctx, phaseReceive, err)
+		}
+
+		received++
+		c.logger.Info("Quote received", zap.String("quote", quote))
+	}
+}
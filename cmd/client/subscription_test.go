@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/loopback"
+	"go.uber.org/zap"
+)
+
+func TestSubscribeEndsAfterDuration(t *testing.T) {
+	listener := loopback.NewListener()
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	// The server answers the subscription and then never pushes anything
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		_, _ = conn.Write([]byte("Challenge:abc;Timestamp:" + time.Now().UTC().Format(time.RFC3339Nano) + ";Difficulty:1\n"))
+		reader := bufio.NewReader(conn)
+		if _, err := reader.ReadString('\n'); err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("Quote:First\n"))
+		_, _ = io.Copy(io.Discard, reader)
+	}()
+
+	cfg := testClientConfig()
+	cfg.ConnectionTimeout = time.Second
+	cfg.SubscribeDuration = 100 * time.Millisecond
+	c := NewClient(cfg, zap.NewNop())
+	c.UseDialer(listener.Dial)
+
+	done := make(chan error, 1)
+	go func() {
+		received, err := c.Subscribe(context.Background())
+		if err == nil && received != 1 {
+			t.Errorf("received %d quotes, want 1", received)
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("subscription over: %v, want a normal end", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription outlived subscribe_duration")
+	}
+}
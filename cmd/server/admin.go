@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// adminPreset is the body returned by the preset endpoints
+type adminPreset struct {
+	Preset string `json:"preset,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// adminServer exposes operator endpoints; it has no authentication and must
+// only listen on an address clients can't reach
+type adminServer struct {
+	server *WordOfWisdomServer
+}
+
+// handler returns the HTTP handler serving the admin endpoints
+func (a *adminServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /preset", a.handleGetPreset)
+	mux.HandleFunc("PUT /preset/{name}", a.handleSetPreset)
+	mux.HandleFunc("GET /stats", a.handleStats)
+	if a.server.config.Dashboard {
+		mux.HandleFunc("GET /{$}", a.handleDashboard)
+	}
+
+	return mux
+}
+
+// handleGetPreset returns the active preset
+func (a *adminServer) handleGetPreset(w http.ResponseWriter, _ *http.Request) {
+	a.writeJSON(w, http.StatusOK, adminPreset{Preset: a.server.activePreset()})
+}
+
+// handleSetPreset switches to the preset named in the path
+func (a *adminServer) handleSetPreset(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := a.server.UsePreset(name); err != nil {
+		a.writeJSON(w, http.StatusNotFound, adminPreset{Error: err.Error()})
+
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, adminPreset{Preset: name})
+}
+
+// writeJSON writes v as the JSON response body
+func (a *adminServer) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.server.logger.Error("write http response failed", zap.Error(err))
+	}
+}
+
+// startAdminServer serves the admin endpoints in the background
+func (s *WordOfWisdomServer) startAdminServer() *http.Server {
+	httpServer := &http.Server{
+		Addr:              s.config.AdminAddress,
+		Handler:           (&adminServer{server: s}).handler(),
+		ReadHeaderTimeout: s.config.ConnectionTimeout,
+		ErrorLog:          zap.NewStdLog(s.logger),
+	}
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("Admin server error", zap.Error(err))
+		}
+	}()
+	s.logger.Info("Admin server started", zap.String("address", s.config.AdminAddress))
+
+	return httpServer
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// authPrefix starts the authentication line clients open with, holding their
+// token
+const authPrefix = "Auth:"
+
+// authenticate reads the authentication line every client must open with
+// once AuthTokens is set and returns the identity its token belongs to.
+// Clients without a valid token are not rejected, they have to solve a
+// challenge like everyone else; the error is for a missing line
+func (s *WordOfWisdomServer) authenticate(conn net.Conn, reader *bufio.Reader, logger *zap.Logger) (string, bool, error) {
+	if len(s.config.AuthTokens) == 0 {
+		return "", false, nil
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(s.limits().ConnectionTimeout)); err != nil {
+		logger.Error("set read deadline failed", zap.Error(err))
+	}
+
+	message, err := readMessage(reader)
+	if err != nil {
+		return "", false, err
+	}
+
+	token, ok := strings.CutPrefix(message, authPrefix)
+	if !ok {
+		return "", false, fmt.Errorf("%w: expected %s<token>", errMalformedResponse, authPrefix)
+	}
+	if token == "" {
+		return "", false, nil
+	}
+
+	identity, ok := s.lookupToken(token)
+	if !ok {
+		logger.Warn("Invalid authentication token", zap.String("client", conn.RemoteAddr().String()))
+
+		return "", false, nil
+	}
+
+	return identity, true, nil
+}
+
+// lookupToken returns the identity of the given token, comparing it against
+// every configured token in constant time
+func (s *WordOfWisdomServer) lookupToken(token string) (string, bool) {
+	var identity string
+	found := false
+
+	for name, expected := range s.config.AuthTokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			identity = name
+			found = true
+		}
+	}
+
+	return identity, found
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestAuthentication(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.AuthTokens = map[string]string{"trusted": "secret"}
+	_, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	// Trusted clients get a quote, the others fall back to the PoW
+	tests := []struct {
+		name, line, answer string
+	}{
+		{"valid token", "Auth:secret\n", "Quote:"},
+		{"invalid token", "Auth:wrong\n", "Challenge:"},
+		{"no token", "Auth:\n", "Challenge:"},
+		{"no authentication", "Nonce:1;Timestamp:x\n", "Error:MALFORMED:"},
+	}
+
+	for _, tt := range tests {
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte(tt.line)); err != nil {
+			t.Fatal(err)
+		}
+		answer, err := bufio.NewReader(conn).ReadString('\n')
+		_ = conn.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !strings.HasPrefix(answer, tt.answer) {
+			t.Errorf("%s: answered %q, want %s", tt.name, answer, tt.answer)
+		}
+	}
+}
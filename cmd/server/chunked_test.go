@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// deadlineConn records the write deadlines set on it and discards writes
+type deadlineConn struct {
+	net.Conn
+	deadlines []time.Time
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+
+	return nil
+}
+
+func TestWriteChunkedKeepsCallerDeadline(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.QuoteChunkBytes = 4
+	s := NewServer(cfg, zap.NewNop())
+
+	// A subscription push must not outlive its deadline, nor lose it
+	deadline := time.Now().Add(time.Second)
+	conn := &deadlineConn{}
+	if err := s.sendQuote(conn, "a quote longer than a chunk", deadline); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.deadlines) < 2 {
+		t.Fatalf("quote written with %d deadlines, want one per chunk", len(conn.deadlines))
+	}
+	for i, got := range conn.deadlines {
+		if !got.Equal(deadline) {
+			t.Errorf("deadline %d is %v, want the caller's %v", i, got, deadline)
+		}
+	}
+
+	// Without a deadline from the caller, none is left in place
+	conn = &deadlineConn{}
+	if err := s.sendQuote(conn, "a quote longer than a chunk", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if last := conn.deadlines[len(conn.deadlines)-1]; !last.IsZero() {
+		t.Errorf("deadline left at %v, want none", last)
+	}
+	for i, got := range conn.deadlines[:len(conn.deadlines)-1] {
+		if got.IsZero() || got.After(time.Now().Add(cfg.ConnectionTimeout)) {
+			t.Errorf("chunk %d written with deadline %v, want within the connection timeout", i, got)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// dashboardRefreshSeconds is how often the dashboard page reloads itself
+const dashboardRefreshSeconds = 5
+
+// dashboardTemplate renders ServerStats as a self-refreshing page
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Word of Wisdom</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+td, th { padding: 0.2em 1em; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Word of Wisdom</h1>
+<table>
+<tr><th>Active clients</th><td>{{.Stats.ActiveClients}}</td></tr>
+<tr><th>Difficulty</th><td>{{.Stats.Difficulty}}</td></tr>
+{{- if .Stats.Preset}}
+<tr><th>Preset</th><td>{{.Stats.Preset}}</td></tr>
+{{- end}}
+<tr><th>Challenges issued</th><td>{{.Stats.ChallengesIssued}}</td></tr>
+<tr><th>Solutions accepted</th><td>{{.Stats.SolutionsAccepted}}</td></tr>
+<tr><th>Solutions rejected</th><td>{{.Stats.SolutionsRejected}}</td></tr>
+<tr><th>Success rate</th><td>{{printf "%.1f%%" .SuccessPercent}}</td></tr>
+</table>
+<h2>Recent quotes</h2>
+<ul>
+{{- range .Stats.RecentQuotes}}
+<li>{{.}}</li>
+{{- else}}
+<li>None yet</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// handleDashboard renders the dashboard
+func (a *adminServer) handleDashboard(w http.ResponseWriter, _ *http.Request) {
+	stats := a.server.Stats()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, struct {
+		Refresh        int
+		Stats          ServerStats
+		SuccessPercent float64
+	}{dashboardRefreshSeconds, stats, stats.SuccessRate() * 100})
+	if err != nil {
+		a.server.logger.Error("render dashboard failed", zap.Error(err))
+	}
+}
+
+// handleStats returns the stats as JSON
+func (a *adminServer) handleStats(w http.ResponseWriter, _ *http.Request) {
+	a.writeJSON(w, http.StatusOK, a.server.Stats())
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDashboardShowsDifficulty(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MinDifficulty = 2
+	cfg.Dashboard = true
+	admin := &adminServer{server: NewServer(cfg, zap.NewNop())}
+
+	recorder := httptest.NewRecorder()
+	admin.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("dashboard status %d, want 200", recorder.Code)
+	}
+	if body := recorder.Body.String(); !strings.Contains(body, "<tr><th>Difficulty</th><td>2</td></tr>") {
+		t.Errorf("dashboard doesn't show difficulty 2:\n%s", body)
+	}
+
+	// Without the dashboard enabled, the admin port has nothing at its root
+	cfg.Dashboard = false
+	admin = &adminServer{server: NewServer(cfg, zap.NewNop())}
+	recorder = httptest.NewRecorder()
+	admin.handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("disabled dashboard status %d, want 404", recorder.Code)
+	}
+}
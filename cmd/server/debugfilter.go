@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// debugCore logs entries of every level to the wrapped core, whatever level
+// the core was built with
+type debugCore struct {
+	zapcore.Core
+}
+
+// Enabled enables every level
+func (c debugCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+// With adds fields to the wrapped core, keeping every level enabled
+func (c debugCore) With(fields []zapcore.Field) zapcore.Core {
+	return debugCore{c.Core.With(fields)}
+}
+
+// Check adds the core to the entry without consulting the wrapped core's
+// level, whose Write doesn't check it again
+func (c debugCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return checked.AddCore(entry, c)
+}
+
+// parseDebugFilter parses the IPs and CIDRs of DebugFilter, skipping invalid
+// ones which the config validation already rejects
+func parseDebugFilter(filter []string) []*net.IPNet {
+	var nets []*net.IPNet
+	for _, entry := range filter {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				continue
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))})
+
+			continue
+		}
+
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+
+	return nets
+}
+
+// connLogger returns the logger of a connection. Connections from the
+// addresses in DebugFilter are tagged and logged at debug level whatever the
+// server's level is, so a single client can be followed in detail
+func (s *WordOfWisdomServer) connLogger(conn net.Conn) *zap.Logger {
+	ip := net.ParseIP(remoteIP(conn))
+	for _, ipNet := range s.debugNets {
+		if ip != nil && ipNet.Contains(ip) {
+			return s.logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+				return debugCore{core}
+			})).With(zap.Bool("debug_filter", true))
+		}
+	}
+
+	return s.logger
+}
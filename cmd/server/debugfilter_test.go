@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDebugFilterReachesVerification(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	cfg := testServerConfig()
+	cfg.DebugFilter = []string{"127.0.0.1"}
+	s := NewServer(cfg, zap.New(core))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Serve(listener)
+	}()
+	defer func() {
+		_ = listener.Close()
+		<-done
+	}()
+	<-s.Ready()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer, err := requestQuote(t, s, conn)
+	_ = conn.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(answer, "Quote:") {
+		t.Fatalf("expected a quote, got %q", answer)
+	}
+
+	// Debug entries of the filtered connection are logged past the info level
+	hashes := logs.FilterMessage("Computed hash").FilterField(zap.Bool("debug_filter", true))
+	if hashes.Len() != 1 {
+		t.Errorf("got %d debug_filter entries for the computed hash, want 1", hashes.Len())
+	}
+}
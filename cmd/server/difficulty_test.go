@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+)
+
+// testServerConfig is a minimal valid server configuration for tests
+func testServerConfig() config.ServerConfig {
+	return config.ServerConfig{
+		MaxConnections:    100,
+		ConnectionTimeout: time.Minute,
+		TimeWindow:        time.Minute,
+		MinDifficulty:     1,
+		MaxDifficulty:     3,
+		HysteresisSamples: 1,
+		RateWindow:        time.Second,
+		ReadBufferBytes:   4096,
+	}
+}
+
+// solveIssued solves challenge by brute force at the issued difficulty, the
+// way an honest client does
+func solveIssued(tb testing.TB, s *WordOfWisdomServer, challenge string, issued replay.Challenge) string {
+	tb.Helper()
+
+	prefix := strings.Repeat("0", issued.Difficulty)
+	for n := uint64(0); ; n++ {
+		nonce := strconv.FormatUint(n, 10)
+		sum := pow.SumWith(s.layout, challenge, nonce, issued.Timestamp, s.config.HashTimestampFormat, issued.Purpose)
+		if strings.HasPrefix(hex.EncodeToString(sum[:]), prefix) {
+			return nonce
+		}
+	}
+}
+
+func TestAdvertisedDifficultyAcceptedUnderLoad(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MinDifficulty, cfg.MaxDifficulty = 3, 3
+
+	// Below, between and above the load thresholds
+	for _, load := range []int{0, config.DefaultConcurrencyMidLoad + 1, config.DefaultConcurrencyMaxLoad + 1} {
+		s := NewServer(cfg, zap.NewNop())
+		s.clientLoad = load
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 40)
+		for range 40 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				difficulty := s.adjustDifficulty()
+				if difficulty != 3 {
+					t.Errorf("load %d: advertised difficulty %d, want 3", load, difficulty)
+				}
+				challenge, err := s.generateChallenge()
+				if err != nil {
+					errs <- err
+
+					return
+				}
+				issued := replay.Challenge{Timestamp: time.Now().UTC(), Difficulty: difficulty}
+				nonce := solveIssued(t, s, challenge, issued)
+				errs <- s.verifyPoW(context.Background(), challenge, issued, nonce, time.Now(), zap.NewNop())
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			if err != nil {
+				t.Errorf("load %d: honest solution rejected: %v", load, err)
+			}
+		}
+	}
+}
+
+func TestVerifyClampsRecordedDifficulty(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MinDifficulty, cfg.MaxDifficulty = 2, 3
+	s := NewServer(cfg, zap.NewNop())
+
+	challenge, err := s.generateChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A record claiming no difficulty at all must not accept any hash
+	issued := replay.Challenge{Timestamp: time.Now().UTC(), Difficulty: 0}
+	for n := uint64(0); n < 64; n++ {
+		nonce := strconv.FormatUint(n, 10)
+		sum := pow.SumWith(nil, challenge, nonce, issued.Timestamp, "", "")
+		if strings.HasPrefix(hex.EncodeToString(sum[:]), "00") {
+			continue
+		}
+		if err := s.verifyPoW(context.Background(), challenge, issued, nonce, time.Now(), zap.NewNop()); err == nil {
+			t.Fatalf("nonce %s accepted below the difficulty floor", nonce)
+		}
+	}
+}
+
+func TestAdjustDifficultyHysteresis(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.HysteresisSamples = 3
+	cfg.HysteresisMargin = 5
+	s := NewServer(cfg, zap.NewNop())
+
+	// sample feeds the load and checks the difficulty after the adjustment
+	sample := func(step string, load, want int) {
+		t.Helper()
+
+		s.clientLoad = load
+		if got := s.adjustDifficulty(); got != want {
+			t.Fatalf("%s: load %d gave difficulty %d, want %d", step, load, got, want)
+		}
+	}
+
+	// Raised only after HysteresisSamples samples above the threshold
+	sample("raise", s.config.MidDifficultyLoad+1, 1)
+	sample("raise", s.config.MidDifficultyLoad+1, 1)
+	sample("raise", s.config.MidDifficultyLoad+1, 2)
+
+	// Hovering around the threshold, but within the margin, doesn't lower it
+	for range 10 {
+		sample("hover", s.config.MidDifficultyLoad-2, 2)
+		sample("hover", s.config.MidDifficultyLoad+1, 2)
+	}
+
+	// Lowered only after HysteresisSamples samples below the margin
+	sample("lower", s.config.MidDifficultyLoad-cfg.HysteresisMargin-1, 2)
+	sample("lower", s.config.MidDifficultyLoad-cfg.HysteresisMargin-1, 2)
+	sample("lower", s.config.MidDifficultyLoad-cfg.HysteresisMargin-1, 1)
+
+	// A load oscillating across the margin never settles long enough to move it
+	for range 10 {
+		sample("oscillate", s.config.MidDifficultyLoad+1, 1)
+		sample("oscillate", s.config.MidDifficultyLoad-cfg.HysteresisMargin-1, 1)
+	}
+}
+
+func TestRateMetricThresholds(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.DifficultyMetric = config.DifficultyMetricRate
+	s := NewServer(cfg, zap.NewNop())
+
+	// 30 requests per second would be a high concurrency, but is a low rate
+	var difficulty int
+	for range 30 {
+		difficulty = s.adjustDifficulty()
+	}
+	if difficulty != cfg.MinDifficulty {
+		t.Errorf("difficulty %d at about 30 requests per second, want %d", difficulty, cfg.MinDifficulty)
+	}
+
+	// Thresholds set explicitly apply to the rate
+	cfg.MidDifficultyLoad, cfg.MaxDifficultyLoad = 5, 10
+	s = NewServer(cfg, zap.NewNop())
+	for range 30 {
+		difficulty = s.adjustDifficulty()
+	}
+	if difficulty != cfg.MaxDifficulty {
+		t.Errorf("difficulty %d at about 30 requests per second, want %d", difficulty, cfg.MaxDifficulty)
+	}
+}
+
+// mockLoadSource reports a fixed aggregated load, or fails when err is set,
+// and signals every poll on polled
+type mockLoadSource struct {
+	load   int
+	err    error
+	polled chan int
+}
+
+// Load records the local load it was given and returns the aggregated one
+func (m *mockLoadSource) Load(_ context.Context, localLoad int) (int, error) {
+	m.polled <- localLoad
+
+	return m.load, m.err
+}
+
+func TestSharedLoadSourceDrivesDifficulty(t *testing.T) {
+	cfg := testServerConfig()
+
+	// pollOnce runs the load poll until source was asked for the load once
+	pollOnce := func(s *WordOfWisdomServer, source *mockLoadSource) {
+		t.Helper()
+
+		s.UseLoadSource(source)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.pollLoadSource(ctx)
+		}()
+		<-source.polled
+		cancel()
+		<-done
+	}
+
+	// Idle locally, but the instances together are past the top threshold
+	s := NewServer(cfg, zap.NewNop())
+	pollOnce(s, &mockLoadSource{load: s.config.MaxDifficultyLoad + 1, polled: make(chan int, 1)})
+	if got := s.adjustDifficulty(); got != cfg.MaxDifficulty {
+		t.Errorf("aggregated load above the top threshold gave difficulty %d, want %d", got, cfg.MaxDifficulty)
+	}
+
+	// An unavailable source leaves the local load in charge
+	s = NewServer(cfg, zap.NewNop())
+	s.clientLoad = s.config.MaxDifficultyLoad + 1
+	pollOnce(s, &mockLoadSource{err: errors.New("unavailable"), polled: make(chan int, 1)})
+	if got := s.adjustDifficulty(); got != cfg.MaxDifficulty {
+		t.Errorf("local load above the top threshold gave difficulty %d, want %d", got, cfg.MaxDifficulty)
+	}
+}
+
+func TestMaxDifficultyStep(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 5
+	cfg.MaxDifficultyStep = 1
+	s := NewServer(cfg, zap.NewNop())
+
+	// A spike straight past the top threshold climbs a step at a time, and
+	// the drop back comes down the same way
+	for _, phase := range []struct {
+		load int
+		want []int
+	}{
+		{s.config.MaxDifficultyLoad + 1, []int{2, 3, 4, 5, 5}},
+		{0, []int{4, 3, 2, 1, 1}},
+	} {
+		s.clientLoad = phase.load
+		for _, want := range phase.want {
+			if got := s.adjustDifficulty(); got != want {
+				t.Fatalf("load %d: difficulty %d, want %d", phase.load, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/protocol"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+)
+
+const (
+	maxHTTPBodyBytes = 4096
+	maxPurposeLength = 64
+)
+
+// httpChallenge is the body returned by GET /challenge
+type httpChallenge struct {
+	Challenge  string    `json:"challenge"`
+	Timestamp  time.Time `json:"timestamp"`
+	Difficulty int       `json:"difficulty"`
+	Purpose    string    `json:"purpose,omitempty"`
+	// NonceEncoding is how the nonce must be written
+	NonceEncoding pow.NonceEncoding `json:"nonce_encoding"`
+}
+
+// httpQuoteRequest is the body expected by POST /quote
+type httpQuoteRequest struct {
+	Challenge string    `json:"challenge"`
+	Nonce     string    `json:"nonce"`
+	Timestamp time.Time `json:"timestamp"`
+	Purpose   string    `json:"purpose,omitempty"`
+}
+
+// httpQuoteResponse is the body returned by POST /quote
+type httpQuoteResponse struct {
+	Quote string `json:"quote,omitempty"`
+	Code  string `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// httpGateway exposes the challenge/response flow over HTTP for clients that
+// can't open raw TCP connections; issued challenges are tracked by the
+// server's replay store
+type httpGateway struct {
+	server *WordOfWisdomServer
+}
+
+// newHTTPGateway creates a gateway backed by the given server
+func newHTTPGateway(server *WordOfWisdomServer) *httpGateway {
+	return &httpGateway{server: server}
+}
+
+// handler returns the HTTP handler serving the gateway endpoints
+func (g *httpGateway) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /challenge", g.handleChallenge)
+	mux.HandleFunc("POST /quote", g.handleQuote)
+
+	return mux
+}
+
+// handleChallenge issues a new challenge, bound to the purpose given in the
+// query or else to the configured one
+func (g *httpGateway) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	purpose := g.server.config.Purpose
+	if r.URL.Query().Has("purpose") {
+		purpose = r.URL.Query().Get("purpose")
+	}
+	if len(purpose) > maxPurposeLength {
+		g.writeJSON(w, http.StatusBadRequest, httpQuoteResponse{Code: protocol.CodeMalformed, Error: "Purpose too long."})
+
+		return
+	}
+
+	issued := replay.Challenge{
+		Timestamp:  time.Now().UTC(),
+		Difficulty: g.server.adjustDifficulty(),
+		Purpose:    purpose,
+	}
+	challenge, err := g.server.generateChallenge()
+	if err != nil {
+		g.server.logger.Error("Failed to generate challenge", zap.Error(err))
+		g.writeJSON(w, http.StatusInternalServerError, httpQuoteResponse{Code: protocol.CodeInternal, Error: "Internal server error."})
+
+		return
+	}
+
+	if err = g.server.replay.Issue(challenge, issued); err != nil {
+		g.server.logger.Error("Failed to record challenge", zap.Error(err))
+		g.writeJSON(w, http.StatusServiceUnavailable, httpQuoteResponse{Code: protocol.CodeBusy, Error: "Server busy."})
+
+		return
+	}
+	g.server.stats.challengeIssued()
+
+	g.writeJSON(w, http.StatusOK, httpChallenge{
+		Challenge:     challenge,
+		Timestamp:     issued.Timestamp,
+		Difficulty:    issued.Difficulty,
+		Purpose:       issued.Purpose,
+		NonceEncoding: g.server.nonceEncoding(),
+	})
+}
+
+// handleQuote verifies a solution and responds with a quote
+func (g *httpGateway) handleQuote(w http.ResponseWriter, r *http.Request) {
+	var req httpQuoteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHTTPBodyBytes)).Decode(&req); err != nil {
+		g.writeJSON(w, http.StatusBadRequest, httpQuoteResponse{Code: protocol.CodeMalformed, Error: "Invalid request body."})
+
+		return
+	}
+
+	// As over TCP, in honeypot mode a rejected request is served all the same
+	issued, rejection := g.checkRequest(req, r.RemoteAddr)
+	var reason error
+	if rejection != nil {
+		reason = rejection.reason
+	} else {
+		reason = g.server.checkSolution(req.Challenge, issued, req.Nonce, req.Timestamp, r.RemoteAddr, g.server.logger)
+	}
+	if !g.server.acceptSolution(reason == nil, r.RemoteAddr, g.server.logger) {
+		g.server.stats.solutionRejected()
+		if rejection != nil {
+			g.server.logger.Warn(rejection.logMessage, zap.String("client", r.RemoteAddr), zap.Error(reason))
+			g.writeJSON(w, http.StatusForbidden, httpQuoteResponse{Code: rejection.code, Error: rejection.message})
+
+			return
+		}
+
+		code := g.server.rejectionCode(issued)
+		g.server.logger.Warn("Invalid PoW attempt", zap.String("client", r.RemoteAddr), zap.String("code", code), zap.Error(reason))
+		g.writeJSON(w, http.StatusForbidden, httpQuoteResponse{Code: code, Error: g.server.rejectionMessage(reason)})
+
+		return
+	}
+
+	quote := g.server.getRandomQuote()
+	g.writeJSON(w, http.StatusOK, httpQuoteResponse{Quote: quote})
+	g.server.stats.solutionAccepted(quote)
+	g.server.logger.Info("Quote sent successfully", zap.String("client", r.RemoteAddr))
+}
+
+// checkRequest takes the challenge of a request and checks that it was
+// issued for the echoed purpose. The rejection is nil when the solution is to
+// be hashed
+func (g *httpGateway) checkRequest(req httpQuoteRequest, clientAddr string) (replay.Challenge, *responseRejection) {
+	issued, rejection := g.server.takeChallenge(req.Challenge)
+	if rejection != nil {
+		return issued, rejection
+	}
+
+	if req.Purpose != issued.Purpose {
+		return issued, &responseRejection{
+			reason:     fmt.Errorf("echoed purpose %q, issued for %q", req.Purpose, issued.Purpose),
+			code:       protocol.CodeMismatch,
+			message:    "Purpose mismatch.",
+			logMessage: "Echoed purpose mismatch",
+			outcome:    outcomeMismatch,
+		}
+	}
+
+	return issued, nil
+}
+
+// writeJSON writes v as the JSON response body
+func (g *httpGateway) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		g.server.logger.Error("write http response failed", zap.Error(err))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+)
+
+// fetchChallenge gets a challenge from the gateway at url, with the given
+// query if any
+func fetchChallenge(t *testing.T, url, query string) httpChallenge {
+	t.Helper()
+
+	resp, err := http.Get(url + "/challenge" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("challenge status %d", resp.StatusCode)
+	}
+	var challenge httpChallenge
+	if err := json.NewDecoder(resp.Body).Decode(&challenge); err != nil {
+		t.Fatal(err)
+	}
+
+	return challenge
+}
+
+// submitQuote posts a solution to the gateway at url, returning the status
+// and body of the answer
+func submitQuote(t *testing.T, url string, request httpQuoteRequest) (int, httpQuoteResponse) {
+	t.Helper()
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(url+"/quote", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var answer httpQuoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, answer
+}
+
+func TestGatewayServesSolvedChallenge(t *testing.T) {
+	s := NewServer(testServerConfig(), zap.NewNop())
+	gateway := httptest.NewServer(newHTTPGateway(s).handler())
+	defer gateway.Close()
+
+	for _, purpose := range []string{"", "signup"} {
+		query := ""
+		if purpose != "" {
+			query = "?purpose=" + purpose
+		}
+		challenge := fetchChallenge(t, gateway.URL, query)
+		if challenge.Purpose != purpose || challenge.Difficulty < 1 || challenge.Challenge == "" {
+			t.Fatalf("purpose %q: issued %+v", purpose, challenge)
+		}
+
+		issued := replay.Challenge{Timestamp: challenge.Timestamp, Difficulty: challenge.Difficulty, Purpose: challenge.Purpose}
+		nonce := solveIssued(t, s, challenge.Challenge, issued)
+		status, answer := submitQuote(t, gateway.URL, httpQuoteRequest{
+			Challenge: challenge.Challenge,
+			Nonce:     nonce,
+			Timestamp: time.Now().UTC(),
+			Purpose:   purpose,
+		})
+		if status != http.StatusOK || answer.Quote == "" || answer.Code != "" {
+			t.Errorf("purpose %q: answered %d %+v, want a quote", purpose, status, answer)
+		}
+	}
+
+	// Garbage bodies are refused before anything is looked up
+	resp, err := http.Post(gateway.URL+"/quote", "application/json", strings.NewReader("{"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("garbage body answered %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestChallengeNamespacesKeepTenantsApart(t *testing.T) {
+	// Two tenants sharing a replay store, each behind its own gateway
+	store := replay.NewMemoryStore(time.Hour, 100)
+	gateways := make(map[string]string)
+	servers := make(map[string]*WordOfWisdomServer)
+	for _, tenant := range []string{"alpha", "beta"} {
+		cfg := testServerConfig()
+		cfg.ChallengeNamespace = tenant
+		s := NewServer(cfg, zap.NewNop())
+		s.UseReplayStore(store)
+		gateway := httptest.NewServer(newHTTPGateway(s).handler())
+		defer gateway.Close()
+		gateways[tenant], servers[tenant] = gateway.URL, s
+	}
+
+	for _, submittedTo := range []string{"beta", "alpha"} {
+		challenge := fetchChallenge(t, gateways["alpha"], "")
+		if !strings.HasPrefix(challenge.Challenge, "alpha.") {
+			t.Fatalf("alpha issued %q outside its namespace", challenge.Challenge)
+		}
+		issued := replay.Challenge{Timestamp: challenge.Timestamp, Difficulty: challenge.Difficulty}
+		nonce := solveIssued(t, servers["alpha"], challenge.Challenge, issued)
+
+		status, answer := submitQuote(t, gateways[submittedTo], httpQuoteRequest{
+			Challenge: challenge.Challenge,
+			Nonce:     nonce,
+			Timestamp: time.Now().UTC(),
+		})
+		served := status == http.StatusOK && answer.Quote != ""
+		if submittedTo == "alpha" && !served {
+			t.Errorf("same namespace submission answered %d %+v, want a quote", status, answer)
+		} else if submittedTo == "beta" && served {
+			t.Error("alpha's solution served by beta")
+		}
+	}
+}
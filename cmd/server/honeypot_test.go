@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// tamper turns the challenge issued by s into a response the server must not
+// accept, e.g. by taking it from the replay store first
+type tamper func(s *WordOfWisdomServer, challenge string) (echoed, purpose string)
+
+// honeypotTampers are the ways a response is rejected, each of which the
+// honeypot serves all the same
+var honeypotTampers = map[string]tamper{
+	"invalid pow": func(_ *WordOfWisdomServer, challenge string) (string, string) {
+		return challenge, ""
+	},
+	"challenge mismatch": func(_ *WordOfWisdomServer, _ string) (string, string) {
+		return "forged", ""
+	},
+	"purpose mismatch": func(_ *WordOfWisdomServer, challenge string) (string, string) {
+		return challenge, "elsewhere"
+	},
+	"replayed": func(s *WordOfWisdomServer, challenge string) (string, string) {
+		_, _, _ = s.replay.Take(challenge)
+
+		return challenge, ""
+	},
+}
+
+func TestHoneypotServesRejectedResponses(t *testing.T) {
+	for name, tamper := range honeypotTampers {
+		for _, honeypot := range []bool{false, true} {
+			cfg := testServerConfig()
+			cfg.RequireChallengeEcho = true
+			cfg.Honeypot = honeypot
+
+			core, logs := observer.New(zapcore.InfoLevel)
+			answer := tamperedExchange(t, cfg, zap.New(core), tamper)
+			if served := strings.HasPrefix(answer, "Quote:"); served != honeypot {
+				t.Errorf("%s with honeypot %t: answered %q", name, honeypot, answer)
+			}
+			assertHoneypotLogged(t, logs, name, honeypot)
+		}
+	}
+}
+
+func TestHoneypotGatewayServesRejectedRequests(t *testing.T) {
+	for name, tamper := range honeypotTampers {
+		for _, honeypot := range []bool{false, true} {
+			cfg := testServerConfig()
+			cfg.Honeypot = honeypot
+
+			core, logs := observer.New(zapcore.InfoLevel)
+			s := NewServer(cfg, zap.New(core))
+			gateway := httptest.NewServer(newHTTPGateway(s).handler())
+
+			status, body := tamperedRequest(t, s, gateway.URL, tamper)
+			gateway.Close()
+			if served := status == http.StatusOK && body.Quote != ""; served != honeypot {
+				t.Errorf("%s with honeypot %t: answered %d %+v", name, honeypot, status, body)
+			}
+			assertHoneypotLogged(t, logs, name, honeypot)
+		}
+	}
+}
+
+// assertHoneypotLogged checks that a honeypot logged serving an invalid
+// solution, and that without the honeypot nothing was logged as served
+func assertHoneypotLogged(t *testing.T, logs *observer.ObservedLogs, name string, honeypot bool) {
+	t.Helper()
+
+	entries := logs.FilterMessage("Honeypot mode, serving quote regardless of PoW").All()
+	if !honeypot {
+		if len(entries) != 0 {
+			t.Errorf("%s without honeypot: logged %d honeypot entries", name, len(entries))
+		}
+
+		return
+	}
+	if len(entries) != 1 {
+		t.Fatalf("%s with honeypot: logged %d honeypot entries, want 1", name, len(entries))
+	}
+	if valid, ok := entries[0].ContextMap()["valid_pow"].(bool); !ok || valid {
+		t.Errorf("%s with honeypot: logged valid_pow %v, want false", name, entries[0].ContextMap()["valid_pow"])
+	}
+}
+
+// invalidNonce returns a nonce that doesn't solve the challenge issued by s
+func invalidNonce(tb testing.TB, s *WordOfWisdomServer, challenge string, issued replay.Challenge) string {
+	tb.Helper()
+
+	prefix := strings.Repeat("0", issued.Difficulty)
+	for n := uint64(0); ; n++ {
+		nonce := strconv.FormatUint(n, 10)
+		sum := pow.SumWith(s.layout, challenge, nonce, issued.Timestamp, s.config.HashTimestampFormat, issued.Purpose)
+		if !strings.HasPrefix(hex.EncodeToString(sum[:]), prefix) {
+			return nonce
+		}
+	}
+}
+
+// tamperedExchange answers the challenge of a server running cfg with an
+// invalid nonce and a response altered by tamper, returning the answer
+func tamperedExchange(t *testing.T, cfg config.ServerConfig, logger *zap.Logger, tamper tamper) string {
+	t.Helper()
+
+	s, listener := startLoopbackServer(t, cfg, logger)
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Split(strings.TrimSpace(line), ";")
+	challenge := strings.TrimPrefix(fields[0], "Challenge:")
+	timestamp, err := time.Parse(time.RFC3339Nano, strings.TrimPrefix(fields[1], "Timestamp:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	difficulty, err := strconv.Atoi(strings.TrimPrefix(fields[2], "Difficulty:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := invalidNonce(t, s, challenge, replay.Challenge{Timestamp: timestamp, Difficulty: difficulty})
+
+	echoed, purpose := tamper(s, challenge)
+	response := fmt.Sprintf("Nonce:%s;Timestamp:%s;Challenge:%s", nonce, time.Now().UTC().Format(time.RFC3339Nano), echoed)
+	if purpose != "" {
+		response += ";Purpose:" + purpose
+	}
+	if _, err := conn.Write([]byte(response + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.TrimSpace(answer)
+}
+
+// tamperedRequest is tamperedExchange over the HTTP gateway at url of s,
+// returning the status and body of the quote request
+func tamperedRequest(t *testing.T, s *WordOfWisdomServer, url string, tamper tamper) (int, httpQuoteResponse) {
+	t.Helper()
+
+	issued := fetchChallenge(t, url, "")
+	nonce := invalidNonce(t, s, issued.Challenge, replay.Challenge{Timestamp: issued.Timestamp, Difficulty: issued.Difficulty})
+
+	echoed, purpose := tamper(s, issued.Challenge)
+
+	return submitQuote(t, url, httpQuoteRequest{Challenge: echoed, Nonce: nonce, Timestamp: time.Now().UTC(), Purpose: purpose})
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"go.uber.org/zap"
+)
+
+// staleLoadIntervals is the number of polling intervals after which an
+// aggregated load is no longer trusted and the local load is used instead
+const staleLoadIntervals = 3
+
+// LoadSource aggregates the load of all server instances
+type LoadSource interface {
+	// Load publishes this instance's local load and returns the aggregated one
+	Load(ctx context.Context, localLoad int) (int, error)
+}
+
+// httpLoadSource is a LoadSource backed by an HTTP aggregation endpoint. It
+// POSTs {"instance": "...", "load": N} and expects {"load": N} in return
+type httpLoadSource struct {
+	url      string
+	instance string
+	client   *http.Client
+}
+
+// loadReport is the body exchanged with the HTTP aggregation endpoint
+type loadReport struct {
+	Instance string `json:"instance,omitempty"`
+	Load     int    `json:"load"`
+}
+
+// newHTTPLoadSource creates a load source posting to the given URL on behalf
+// of the named instance
+func newHTTPLoadSource(url, instance string, timeout time.Duration) *httpLoadSource {
+	return &httpLoadSource{
+		url:      url,
+		instance: instance,
+		client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Load publishes the local load and returns the aggregated load
+func (h *httpLoadSource) Load(ctx context.Context, localLoad int) (int, error) {
+	body, err := json.Marshal(loadReport{Instance: h.instance, Load: localLoad})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var aggregated loadReport
+	if err := json.NewDecoder(resp.Body).Decode(&aggregated); err != nil {
+		return 0, fmt.Errorf("invalid load response: %w", err)
+	}
+
+	return aggregated.Load, nil
+}
+
+// UseLoadSource makes the difficulty follow the load aggregated by source
+// rather than only this instance's load
+func (s *WordOfWisdomServer) UseLoadSource(source LoadSource) {
+	s.loadSource = source
+}
+
+// pollLoadSource refreshes the aggregated load every SharedLoadInterval until
+// ctx is done
+func (s *WordOfWisdomServer) pollLoadSource(ctx context.Context) {
+	defer s.crashOnPanic("load poll")
+
+	ticker := time.NewTicker(s.config.SharedLoadInterval)
+	defer ticker.Stop()
+
+	for {
+		s.mu.Lock()
+		localLoad := s.localLoad()
+		s.mu.Unlock()
+
+		load, err := s.loadSource.Load(ctx, localLoad)
+		if err != nil {
+			s.logger.Warn("Failed to fetch shared load, using local load", zap.Error(err))
+		} else {
+			s.mu.Lock()
+			s.sharedLoad = load
+			s.sharedLoadAt = time.Now()
+			s.mu.Unlock()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// currentLoad returns the aggregated load while it is fresh and the local
+// load otherwise, the caller must hold the lock
+func (s *WordOfWisdomServer) currentLoad() int {
+	if s.loadSource != nil && time.Since(s.sharedLoadAt) <= staleLoadIntervals*s.config.SharedLoadInterval {
+		return s.sharedLoad
+	}
+
+	return s.localLoad()
+}
+
+// localLoad returns this instance's load according to the configured metric:
+// the number of connected clients or the number of requests per second. The
+// caller must hold the lock
+func (s *WordOfWisdomServer) localLoad() int {
+	if s.config.DifficultyMetric == config.DifficultyMetricRate {
+		return int(s.requestRate.perSecond(time.Now()))
+	}
+
+	return s.clientLoad
+}
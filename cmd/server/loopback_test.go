@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/loopback"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+)
+
+// startLoopbackServer serves cfg on an in-memory listener until the test ends
+func startLoopbackServer(tb testing.TB, cfg config.ServerConfig, logger *zap.Logger) (*WordOfWisdomServer, *loopback.Listener) {
+	tb.Helper()
+
+	s := NewServer(cfg, logger)
+	listener := loopback.NewListener()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Serve(listener)
+	}()
+	tb.Cleanup(func() {
+		_ = listener.Close()
+		<-done
+	})
+
+	// Connections accepted before the workers wait for them are refused
+	<-s.Ready()
+
+	return s, listener
+}
+
+// requestQuote runs one exchange on conn the way an honest client does:
+// receive the challenge, solve it and return the server's answer
+func requestQuote(tb testing.TB, s *WordOfWisdomServer, conn net.Conn) (string, error) {
+	tb.Helper()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	response, ok, err := solutionFor(tb, s, line)
+	if err != nil || !ok {
+		return strings.TrimSpace(line), err
+	}
+	if _, err := conn.Write([]byte(response + "\n")); err != nil {
+		return "", err
+	}
+
+	answer, err := reader.ReadString('\n')
+
+	return strings.TrimSpace(answer), err
+}
+
+// solutionFor solves the challenge line sent by s and returns the response
+// an honest client sends, reporting false when the line holds no challenge
+func solutionFor(tb testing.TB, s *WordOfWisdomServer, line string) (string, bool, error) {
+	tb.Helper()
+
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimSpace(line), ";") {
+		key, value, _ := strings.Cut(part, ":")
+		fields[key] = value
+	}
+	if _, ok := fields["Challenge"]; !ok {
+		return "", false, nil
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, fields["Timestamp"])
+	if err != nil {
+		return "", false, err
+	}
+	difficulty, err := strconv.Atoi(fields["Difficulty"])
+	if err != nil {
+		return "", false, err
+	}
+
+	issued := replay.Challenge{Timestamp: timestamp, Difficulty: difficulty, Purpose: fields["Purpose"]}
+	nonce := solveIssued(tb, s, fields["Challenge"], issued)
+	response := fmt.Sprintf("Nonce:%s;Timestamp:%s;Attempts:1;Challenge:%s",
+		nonce, time.Now().UTC().Format(time.RFC3339Nano), fields["Challenge"])
+	if issued.Purpose != "" {
+		response += ";Purpose:" + issued.Purpose
+	}
+
+	return response, true, nil
+}
+
+func BenchmarkFullCycle(b *testing.B) {
+	s, listener := startLoopbackServer(b, testServerConfig(), zap.NewNop())
+
+	b.ResetTimer()
+	for range b.N {
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		answer, err := requestQuote(b, s, conn)
+		_ = conn.Close()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if !strings.HasPrefix(answer, "Quote:") {
+			b.Fatalf("expected a quote, got %q", answer)
+		}
+	}
+}
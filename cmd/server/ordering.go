@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errOutOfOrder is returned for a client sending a response before it was
+// sent the challenge
+var errOutOfOrder = errors.New("response sent before the challenge")
+
+// orderingReadBytes is how much an orderedConn reads from the client at once
+const orderingReadBytes = 4096
+
+// protocolState is where a connection stands in the exchange
+type protocolState int
+
+const (
+	// stateAwaitingChallenge is before the challenge was sent and after the
+	// response to it arrived; only authentication may be sent
+	stateAwaitingChallenge protocolState = iota
+	// stateChallengeSent is while the client works on its challenge; its
+	// response and keep-alive pings may be sent
+	stateChallengeSent
+)
+
+// orderedConn is a connection that reads from the client in the background,
+// so that it knows in which protocol state every line arrived rather than in
+// which state the server got to read it. A line other than authentication
+// arriving while no challenge is outstanding puts it out of order
+type orderedConn struct {
+	net.Conn
+	// limit is how many unread bytes are buffered before reading pauses
+	limit int
+	// done is closed once the background reader has returned
+	done chan struct{}
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// buffered holds the bytes read from the client but not yet by the server
+	buffered []byte
+	// err is the error reading from the client, returned once buffered is
+	// drained
+	err error
+	// readDeadline applies to Read, the background reader has none
+	readDeadline time.Time
+
+	state protocolState
+	// line holds the start of the line being received, up to the length of
+	// the authentication prefix; lineState is the state its first byte
+	// arrived in
+	line        []byte
+	lineState   protocolState
+	lineStarted bool
+	// outOfOrder is set once a line arrived in a state not expecting it
+	outOfOrder bool
+}
+
+// newOrderedConn wraps conn and starts reading from it; limit bounds the
+// unread bytes buffered
+func newOrderedConn(conn net.Conn, limit int) *orderedConn {
+	c := &orderedConn{Conn: conn, limit: max(limit, orderingReadBytes), done: make(chan struct{})}
+	c.cond = sync.NewCond(&c.mu)
+	go c.readLoop()
+
+	return c
+}
+
+// readLoop reads from the client until it fails or the connection is closed
+func (c *orderedConn) readLoop() {
+	defer close(c.done)
+
+	chunk := make([]byte, orderingReadBytes)
+	for {
+		c.mu.Lock()
+		for len(c.buffered) >= c.limit && c.err == nil {
+			c.cond.Wait()
+		}
+		closed := c.err != nil
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+
+		n, err := c.Conn.Read(chunk)
+
+		c.mu.Lock()
+		c.receive(chunk[:n])
+		if err != nil && c.err == nil {
+			c.err = err
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// receive buffers bytes that just arrived and notes the state every line
+// started in. The caller must hold the lock
+func (c *orderedConn) receive(data []byte) {
+	c.buffered = append(c.buffered, data...)
+
+	for len(data) > 0 {
+		if !c.lineStarted {
+			c.lineState = c.state
+			c.lineStarted = true
+		}
+
+		end := bytes.IndexByte(data, '\n')
+		part := data
+		if end >= 0 {
+			part = data[:end]
+		}
+		if room := len(authPrefix) - len(c.line); room > 0 {
+			c.line = append(c.line, part[:min(room, len(part))]...)
+		}
+		if end < 0 {
+			return
+		}
+
+		c.endLine()
+		data = data[end+1:]
+	}
+}
+
+// endLine advances the state on a complete line. A response ends the
+// challenge, pings keep it going, and only authentication may come while no
+// challenge is outstanding. The caller must hold the lock
+func (c *orderedConn) endLine() {
+	line := strings.TrimSpace(string(c.line))
+
+	switch {
+	case strings.HasPrefix(line, authPrefix):
+	case c.lineState == stateChallengeSent && line == pingMessage:
+	case c.lineState == stateChallengeSent:
+		c.state = stateAwaitingChallenge
+	default:
+		c.outOfOrder = true
+	}
+
+	c.line = c.line[:0]
+	c.lineStarted = false
+}
+
+// beginChallenge moves to the challenge sent state right before the
+// challenge is written, failing with errOutOfOrder when the client sent
+// anything it shouldn't have so far
+func (c *orderedConn) beginChallenge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// A line still arriving may only be authentication
+	if c.outOfOrder || !strings.HasPrefix(authPrefix, string(c.line)) && !strings.HasPrefix(string(c.line), authPrefix) {
+		return errOutOfOrder
+	}
+	c.state = stateChallengeSent
+
+	return nil
+}
+
+// Read returns the bytes received from the client, waiting for some until
+// the read deadline
+func (c *orderedConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The timer wakes Read up at the deadline, it is replaced whenever the
+	// deadline changes
+	var timer *time.Timer
+	var timerDeadline time.Time
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for len(c.buffered) == 0 && c.err == nil {
+		if !c.readDeadline.IsZero() {
+			wait := time.Until(c.readDeadline)
+			if wait <= 0 {
+				return 0, os.ErrDeadlineExceeded
+			}
+			if timer == nil || !timerDeadline.Equal(c.readDeadline) {
+				if timer != nil {
+					timer.Stop()
+				}
+				timerDeadline = c.readDeadline
+				timer = time.AfterFunc(wait, func() {
+					c.mu.Lock()
+					c.cond.Broadcast()
+					c.mu.Unlock()
+				})
+			}
+		}
+		c.cond.Wait()
+	}
+
+	if len(c.buffered) == 0 {
+		return 0, c.err
+	}
+
+	n := copy(b, c.buffered)
+	c.buffered = c.buffered[n:]
+	c.cond.Broadcast()
+
+	return n, nil
+}
+
+// SetReadDeadline sets the deadline of Read, waking it up to check it
+func (c *orderedConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.readDeadline = t
+	c.cond.Broadcast()
+
+	return nil
+}
+
+// SetDeadline sets the read deadline of Read and the write deadline of the
+// connection
+func (c *orderedConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+
+	return c.Conn.SetWriteDeadline(t)
+}
+
+// Close closes the connection and waits for the background reader to stop,
+// releasing what it buffered
+func (c *orderedConn) Close() error {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = net.ErrClosed
+	}
+	c.buffered = nil
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	err := c.Conn.Close()
+	<-c.done
+
+	return err
+}
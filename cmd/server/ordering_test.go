@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// sendLines writes lines to the client end of an orderedConn and waits for
+// the background reader to take them in
+func sendLines(t *testing.T, client net.Conn, lines ...string) {
+	t.Helper()
+
+	for _, line := range lines {
+		if _, err := client.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// net.Pipe hands the bytes over once they are read, give the reader time
+	// to take them in
+	time.Sleep(10 * time.Millisecond)
+}
+
+func TestOrderedConnRejectsEarlyResponse(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+	c := newOrderedConn(server, 4096)
+	defer func() { _ = c.Close() }()
+
+	// Read by the server long before the challenge, as the old probe would
+	// have missed it
+	sendLines(t, client, "Nonce:1;Timestamp:x;Challenge:y\n")
+	line, err := bufio.NewReader(c).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "Nonce:") {
+		t.Fatalf("read %q, %v", line, err)
+	}
+
+	if err := c.beginChallenge(); !errors.Is(err, errOutOfOrder) {
+		t.Fatalf("beginChallenge: %v, want %v", err, errOutOfOrder)
+	}
+}
+
+func TestOrderedConnStates(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+	c := newOrderedConn(server, 4096)
+	defer func() { _ = c.Close() }()
+
+	// Authentication, even in the middle of arriving, may precede a challenge
+	sendLines(t, client, "Auth:token\n", "Au")
+	if err := c.beginChallenge(); err != nil {
+		t.Fatalf("first challenge: %v", err)
+	}
+
+	// Pings keep the challenge going, the response ends it
+	sendLines(t, client, "th:token\n", pingMessage+"\n", pingMessage+"\n", "Nonce:1\n")
+	if err := c.beginChallenge(); err != nil {
+		t.Fatalf("second challenge: %v", err)
+	}
+
+	// A response pipelined ahead of the third challenge is out of order
+	sendLines(t, client, "Nonce:2\n", "Nonce:3\n")
+	if err := c.beginChallenge(); !errors.Is(err, errOutOfOrder) {
+		t.Fatalf("third challenge: %v, want %v", err, errOutOfOrder)
+	}
+}
+
+func TestOrderedConnCloseStopsReader(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+	c := newOrderedConn(server, 4096)
+
+	// More garbage than the buffer holds, the reader pauses once it is full
+	go func() {
+		_, _ = client.Write(make([]byte, 3*orderingReadBytes))
+	}()
+	deadline := time.Now().Add(time.Second)
+	for {
+		c.mu.Lock()
+		full := len(c.buffered) >= c.limit
+		c.mu.Unlock()
+		if full {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("buffer never filled up")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c.Close()
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't stop the background reader")
+	}
+	select {
+	case <-c.done:
+	default:
+		t.Fatal("background reader still running after Close")
+	}
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("read after close: %v, want %v", err, net.ErrClosed)
+	}
+}
+
+func TestOrderedConnReadDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer func() { _ = client.Close() }()
+	c := newOrderedConn(server, 4096)
+	defer func() { _ = c.Close() }()
+
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read: %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+
+	// A deadline extended while Read waits is honored
+	if err := c.SetReadDeadline(time.Now().Add(10 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(5 * time.Millisecond)
+	start := time.Now()
+	if err := c.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read: %v, want %v", err, os.ErrDeadlineExceeded)
+	}
+	if waited := time.Since(start); waited < 40*time.Millisecond {
+		t.Fatalf("read gave up after %v, before the extended deadline", waited)
+	}
+}
+
+func TestStrictOrderingServesHonestClients(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.StrictOrdering = true
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	for _, auth := range []string{"", "Auth:unknown\n"} {
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if auth != "" {
+			if _, err := conn.Write([]byte(auth)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		answer, err := requestQuote(t, s, conn)
+		_ = conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(answer, "Quote:") {
+			t.Fatalf("auth %q: expected a quote, got %q", auth, answer)
+		}
+	}
+}
+
+func TestStrictOrderingRejectsEarlyResponse(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.StrictOrdering = true
+	cfg.AuthTokens = map[string]string{"trusted": "secret"}
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The response arrives along with the authentication, before the challenge
+	if _, err := conn.Write([]byte("Auth:unknown\nNonce:1;Timestamp:x;Challenge:y\n")); err != nil {
+		t.Fatal(err)
+	}
+	answer, err := requestQuote(t, s, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(answer, "Error:MALFORMED:") {
+		t.Fatalf("expected MALFORMED, got %q", answer)
+	}
+}
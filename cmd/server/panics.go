@@ -0,0 +1,25 @@
+package main
+
+import (
+	"go.uber.org/zap"
+)
+
+// crashOnPanic logs a panic of the calling goroutine along with its stack
+// trace before letting it crash the process; it must be deferred
+func (s *WordOfWisdomServer) crashOnPanic(goroutine string) {
+	if r := recover(); r != nil {
+		s.logger.Error("Goroutine panicked", zap.String("goroutine", goroutine), zap.Any("panic", r), zap.Stack("stack"))
+		_ = s.logger.Sync()
+
+		panic(r)
+	}
+}
+
+// recoverConnection logs a panic while handling a connection along with its
+// stack trace and recovers, so that the worker moves on to the next
+// connection; it must be deferred
+func (s *WordOfWisdomServer) recoverConnection(clientAddr string) {
+	if r := recover(); r != nil {
+		s.logger.Error("Panic handling connection", zap.String("client", clientAddr), zap.Any("panic", r), zap.Stack("stack"))
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// assertPanicLogged checks that a single entry with message was logged, with
+// the panic value and a stack trace
+func assertPanicLogged(t *testing.T, logs *observer.ObservedLogs, message string, value any) {
+	t.Helper()
+
+	entries := logs.FilterMessage(message).AllUntimed()
+	if len(entries) != 1 {
+		t.Fatalf("got %d %q entries, want 1", len(entries), message)
+	}
+
+	fields := entries[0].ContextMap()
+	if fields["panic"] != value {
+		t.Errorf("panic field %v, want %v", fields["panic"], value)
+	}
+	if stack, _ := fields["stack"].(string); !strings.Contains(stack, "panic") {
+		t.Errorf("stack field %q has no trace of the panic", stack)
+	}
+}
+
+func TestRecoverConnectionLogsPanic(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	s, listener := startLoopbackServer(t, testServerConfig(), zap.New(core))
+
+	// The first verification panics, the next ones verify as usual
+	var calls atomic.Int32
+	s.verify = func(ctx context.Context, challenge string, issued replay.Challenge, nonce string, clientTimestamp time.Time, logger *zap.Logger) error {
+		if calls.Add(1) == 1 {
+			panic("verification exploded")
+		}
+
+		return s.verifyPoW(ctx, challenge, issued, nonce, clientTimestamp, logger)
+	}
+
+	// The panicking connection is dropped, the worker serves the next one
+	answers := make([]string, 2)
+	for i := range answers {
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		answers[i], _ = requestQuote(t, s, conn)
+		_ = conn.Close()
+	}
+	if answers[0] != "" {
+		t.Errorf("panicking connection answered %q", answers[0])
+	}
+	if !strings.HasPrefix(answers[1], "Quote:") {
+		t.Errorf("next connection answered %q, want a quote", answers[1])
+	}
+
+	assertPanicLogged(t, logs, "Panic handling connection", "verification exploded")
+}
+
+func TestCrashOnPanicLogsAndRepanics(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	s := NewServer(testServerConfig(), zap.New(core))
+
+	var recovered any
+	func() {
+		defer func() {
+			recovered = recover()
+		}()
+		defer s.crashOnPanic("worker")
+
+		panic("worker exploded")
+	}()
+
+	if recovered != "worker exploded" {
+		t.Errorf("recovered %v, want the panic to go on", recovered)
+	}
+	assertPanicLogged(t, logs, "Goroutine panicked", "worker exploded")
+}
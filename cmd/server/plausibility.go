@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/recording"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+)
+
+// checkSolution verifies a solution and flags the ones solved implausibly
+// fast for their difficulty, as they may have been replayed or precomputed.
+// Flagged solutions are rejected when RejectFastSolves is set. The reason of
+// a rejection is returned, nil when the solution is accepted; only accepted
+// solutions are recorded
+func (s *WordOfWisdomServer) checkSolution(challenge string, issued replay.Challenge, nonce string, clientTimestamp time.Time, clientAddr string, logger *zap.Logger) error {
+	reason := s.judgeSolution(challenge, issued, nonce, clientTimestamp, clientAddr, logger)
+	if reason == nil {
+		s.recordSolution(challenge, issued, nonce, clientTimestamp, logger)
+	}
+
+	return reason
+}
+
+// judgeSolution returns why checkSolution rejects a solution, nil when it
+// accepts it
+func (s *WordOfWisdomServer) judgeSolution(challenge string, issued replay.Challenge, nonce string, clientTimestamp time.Time, clientAddr string, logger *zap.Logger) error {
+	if err := s.verifyWithinLimit(challenge, issued, nonce, clientTimestamp, clientAddr, logger); err != nil {
+		return err
+	}
+
+	if !s.checkNonceLikelihood(nonce, issued.Difficulty, clientAddr, logger) {
+		return fmt.Errorf("nonce %s is implausibly small for difficulty %d", nonce, issued.Difficulty)
+	}
+
+	solveTime := clientTimestamp.Sub(issued.Timestamp)
+	expected, ok := s.expectedSolveTime(issued.Difficulty)
+	if !ok || float64(solveTime) >= s.config.FastSolveFraction*float64(expected) {
+		return nil
+	}
+
+	logger.Warn("Implausibly fast solve",
+		zap.String("client", clientAddr),
+		zap.Int("difficulty", issued.Difficulty),
+		zap.Duration("solve_time", solveTime),
+		zap.Duration("expected_solve_time", expected),
+		zap.Bool("rejected", s.config.RejectFastSolves),
+	)
+	if !s.config.RejectFastSolves {
+		return nil
+	}
+
+	return fmt.Errorf("solved in %s, implausibly fast for difficulty %d", solveTime, issued.Difficulty)
+}
+
+// verifyWithinLimit verifies a solution, failing it when verification takes
+// longer than VerifyTimeout so that expensive schemes can't be abused to tie
+// up the server. The verification is canceled at the deadline. A panic while
+// verifying fails the solution, as it would only drop the connection without
+// the limit
+func (s *WordOfWisdomServer) verifyWithinLimit(challenge string, issued replay.Challenge, nonce string, clientTimestamp time.Time, clientAddr string, logger *zap.Logger) error {
+	if s.config.VerifyTimeout <= 0 {
+		return s.verify(context.Background(), challenge, issued, nonce, clientTimestamp, logger)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.VerifyTimeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error("Verification panicked", zap.String("client", clientAddr), zap.Any("panic", r), zap.Stack("stack"))
+				result <- fmt.Errorf("verification panicked: %v", r)
+			}
+		}()
+
+		result <- s.verify(ctx, challenge, issued, nonce, clientTimestamp, logger)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		logger.Warn("Verification timed out", zap.String("client", clientAddr), zap.Duration("verify_timeout", s.config.VerifyTimeout))
+
+		return fmt.Errorf("verification took longer than %s", s.config.VerifyTimeout)
+	}
+}
+
+// checkNonceLikelihood flags numeric nonces too small for their difficulty:
+// a search from 0 finds a solution within nonce+1 hashes with a likelihood of
+// about (nonce+1)/16^difficulty, so a tiny nonce hints at a forged or replayed
+// challenge. Flagged nonces are rejected when RejectUnlikelyNonces is set
+func (s *WordOfWisdomServer) checkNonceLikelihood(nonce string, difficulty int, clientAddr string, logger *zap.Logger) bool {
+	if s.config.MinNonceLikelihood <= 0 {
+		return true
+	}
+
+	value, err := strconv.ParseUint(nonce, 10, 64)
+	if err != nil {
+		return true
+	}
+
+	likelihood := (float64(value) + 1) / pow.ExpectedAttempts(difficulty)
+	if likelihood >= s.config.MinNonceLikelihood {
+		return true
+	}
+
+	logger.Warn("Implausibly small nonce",
+		zap.String("client", clientAddr),
+		zap.String("nonce", nonce),
+		zap.Int("difficulty", difficulty),
+		zap.Float64("likelihood", likelihood),
+		zap.Bool("rejected", s.config.RejectUnlikelyNonces),
+	)
+
+	return !s.config.RejectUnlikelyNonces
+}
+
+// expectedSolveTime returns the expected time to solve a challenge of the
+// given difficulty at FastSolveHashRate, reporting false when fast solve
+// detection is disabled
+func (s *WordOfWisdomServer) expectedSolveTime(difficulty int) (time.Duration, bool) {
+	if s.config.FastSolveHashRate <= 0 || s.config.FastSolveFraction <= 0 {
+		return 0, false
+	}
+
+	seconds := pow.ExpectedAttempts(difficulty) / s.config.FastSolveHashRate
+
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// recordSolution records an accepted solution when recording is enabled
+func (s *WordOfWisdomServer) recordSolution(challenge string, issued replay.Challenge, nonce string, clientTimestamp time.Time, logger *zap.Logger) {
+	if s.recorder == nil {
+		return
+	}
+
+	err := s.recorder.Record(recording.Solution{
+		Challenge:       challenge,
+		Timestamp:       issued.Timestamp,
+		Difficulty:      issued.Difficulty,
+		Nonce:           nonce,
+		ClientTimestamp: clientTimestamp,
+		Purpose:         issued.Purpose,
+		TimestampFormat: s.config.HashTimestampFormat,
+	})
+	if err != nil {
+		logger.Error("Failed to record solution", zap.Error(err))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestVerifyTimeoutStopsSlowScheme(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.VerifyTimeout = 50 * time.Millisecond
+	s := NewServer(cfg, zap.NewNop())
+
+	// A scheme far slower than the limit, giving up only when canceled
+	stopped := make(chan struct{})
+	s.verify = func(ctx context.Context, _ string, _ replay.Challenge, _ string, _ time.Time, _ *zap.Logger) error {
+		defer close(stopped)
+
+		select {
+		case <-time.After(time.Minute):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	start := time.Now()
+	err := s.verifyWithinLimit("challenge", replay.Challenge{Timestamp: start}, "0", start, "client", zap.NewNop())
+	if err == nil {
+		t.Fatal("slow verification accepted past the limit")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("verification gave up after %s, want about %s", elapsed, cfg.VerifyTimeout)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("verification kept running after the limit")
+	}
+}
+
+func TestVerifyTimeoutPassesFastScheme(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.VerifyTimeout = time.Second
+	s := NewServer(cfg, zap.NewNop())
+
+	challenge, err := s.generateChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := replay.Challenge{Timestamp: time.Now().UTC(), Difficulty: 1}
+	nonce := solveIssued(t, s, challenge, issued)
+
+	if err := s.verifyWithinLimit(challenge, issued, nonce, time.Now(), "client", zap.NewNop()); err != nil {
+		t.Errorf("valid solution rejected: %v", err)
+	}
+}
+
+func TestVerifyTimeoutFailsPanickingScheme(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.VerifyTimeout = time.Second
+	s := NewServer(cfg, zap.NewNop())
+
+	// A crafted input crashing the scheme only fails its own solution
+	s.verify = func(context.Context, string, replay.Challenge, string, time.Time, *zap.Logger) error {
+		panic("crafted input")
+	}
+
+	start := time.Now()
+	err := s.verifyWithinLimit("challenge", replay.Challenge{Timestamp: start}, "0", start, "client", zap.NewNop())
+	if err == nil || !strings.Contains(err.Error(), "verification panicked: crafted input") {
+		t.Fatalf("verification error %v, want the panic reported", err)
+	}
+	if elapsed := time.Since(start); elapsed >= cfg.VerifyTimeout {
+		t.Errorf("panic reported after %s, only once the limit was reached", elapsed)
+	}
+}
+
+func TestFastSolveFlagged(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		cfg := testServerConfig()
+		// At a hash per second a difficulty 2 challenge takes minutes
+		cfg.FastSolveHashRate = 1
+		cfg.FastSolveFraction = 0.5
+		cfg.RejectFastSolves = reject
+		core, logs := observer.New(zap.WarnLevel)
+		s := NewServer(cfg, zap.New(core))
+
+		challenge, err := s.generateChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		issued := replay.Challenge{Timestamp: time.Now().UTC(), Difficulty: 2}
+		nonce := solveIssued(t, s, challenge, issued)
+
+		// A valid solution submitted a millisecond after the challenge
+		err = s.checkSolution(challenge, issued, nonce, issued.Timestamp.Add(time.Millisecond), "client", s.logger)
+		if reject && err == nil {
+			t.Error("implausibly fast solve accepted with reject_fast_solves")
+		} else if !reject && err != nil {
+			t.Errorf("implausibly fast solve rejected without reject_fast_solves: %v", err)
+		}
+		if logs.FilterMessage("Implausibly fast solve").Len() != 1 {
+			t.Errorf("reject %t: fast solve not flagged, logged %v", reject, logs.All())
+		}
+	}
+}
+
+func TestSmallNonceFlagged(t *testing.T) {
+	for _, reject := range []bool{false, true} {
+		cfg := testServerConfig()
+		cfg.MinNonceLikelihood = 1e-3
+		cfg.RejectUnlikelyNonces = reject
+		core, logs := observer.New(zap.WarnLevel)
+		s := NewServer(cfg, zap.New(core))
+
+		// Nonce 0 solving difficulty 5 happens once in about a million
+		// challenges, a nonce near the expected attempts is unremarkable
+		if ok := s.checkNonceLikelihood("0", 5, "client", s.logger); ok == reject {
+			t.Errorf("reject %t: nonce 0 at difficulty 5 passed %t", reject, ok)
+		}
+		if !s.checkNonceLikelihood("1000000", 5, "client", s.logger) {
+			t.Errorf("reject %t: nonce 1000000 at difficulty 5 rejected", reject)
+		}
+		if flagged := logs.FilterMessage("Implausibly small nonce").Len(); flagged != 1 {
+			t.Errorf("reject %t: %d nonces flagged, want only nonce 0", reject, flagged)
+		}
+	}
+}
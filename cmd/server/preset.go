@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"go.uber.org/zap"
+)
+
+// initialPreset returns the settings the server starts with: the configured
+// preset if any, the top-level settings otherwise
+func initialPreset(cfg config.ServerConfig) config.Preset {
+	if preset, ok := cfg.Presets[cfg.Preset]; ok {
+		return preset
+	}
+
+	return config.Preset{
+		MinDifficulty:     cfg.MinDifficulty,
+		MaxDifficulty:     cfg.MaxDifficulty,
+		ConnectionTimeout: cfg.ConnectionTimeout,
+	}
+}
+
+// highestMaxDifficulty returns the highest difficulty the server may issue
+// under any preset
+func highestMaxDifficulty(cfg config.ServerConfig) int {
+	highest := cfg.MaxDifficulty
+	for _, preset := range cfg.Presets {
+		highest = max(highest, preset.MaxDifficulty)
+	}
+
+	return highest
+}
+
+// lowestMinDifficulty returns the lowest difficulty the server may issue
+// under any preset, so that switching presets doesn't fail the challenges
+// already issued
+func lowestMinDifficulty(cfg config.ServerConfig) int {
+	lowest := cfg.MinDifficulty
+	for _, preset := range cfg.Presets {
+		lowest = min(lowest, preset.MinDifficulty)
+	}
+
+	return lowest
+}
+
+// UsePreset switches to the named preset; connections accepted afterwards
+// use its settings while the ones in flight keep their issued difficulty
+func (s *WordOfWisdomServer) UsePreset(name string) error {
+	preset, ok := s.config.Presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.preset = preset
+	s.presetName = name
+	s.difficulty = s.capDifficulty(min(max(s.difficulty, preset.MinDifficulty), preset.MaxDifficulty))
+	s.pendingSamples = 0
+
+	s.logger.Info("Preset activated", zap.String("preset", name),
+		zap.Int("min_difficulty", preset.MinDifficulty), zap.Int("max_difficulty", preset.MaxDifficulty),
+		zap.Duration("conn_timeout", preset.ConnectionTimeout))
+
+	return nil
+}
+
+// limits returns the settings of the active preset
+func (s *WordOfWisdomServer) limits() config.Preset {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.preset
+}
+
+// activePreset returns the name of the active preset, empty when the
+// top-level settings are in use
+func (s *WordOfWisdomServer) activePreset() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.presetName
+}
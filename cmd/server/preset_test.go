@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"go.uber.org/zap"
+)
+
+func TestUsePresetSwitchesDifficulty(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.Presets = map[string]config.Preset{
+		"low":  {MinDifficulty: 1, MaxDifficulty: 1, ConnectionTimeout: cfg.ConnectionTimeout},
+		"high": {MinDifficulty: 3, MaxDifficulty: 3, ConnectionTimeout: cfg.ConnectionTimeout},
+	}
+	cfg.Preset = "low"
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	// advertised connects and returns the difficulty of the challenge, which
+	// is then solved
+	advertised := func() string {
+		t.Helper()
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, ok, err := solutionFor(t, s, line)
+		if err != nil || !ok {
+			t.Fatalf("no challenge in %q: %v", line, err)
+		}
+		if _, err := conn.Write([]byte(response + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Quote:") {
+			t.Fatalf("answered %q, %v; want a quote", answer, err)
+		}
+
+		for _, part := range strings.Split(strings.TrimSpace(line), ";") {
+			if difficulty, ok := strings.CutPrefix(part, "Difficulty:"); ok {
+				return difficulty
+			}
+		}
+
+		return ""
+	}
+
+	if difficulty := advertised(); difficulty != "1" {
+		t.Fatalf("low preset advertised difficulty %s, want 1", difficulty)
+	}
+
+	if err := s.UsePreset("high"); err != nil {
+		t.Fatal(err)
+	}
+	if difficulty := advertised(); difficulty != "3" {
+		t.Errorf("high preset advertised difficulty %s, want 3", difficulty)
+	}
+
+	if err := s.UsePreset("missing"); err == nil {
+		t.Error("unknown preset activated")
+	}
+	if name := s.activePreset(); name != "high" {
+		t.Errorf("active preset %q after a failed switch, want high", name)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "time"
+
+// rateBuckets is the number of buckets the request rate window is split into
+const rateBuckets = 10
+
+// requestRate counts requests over a sliding window split into buckets, so
+// that recording and reading are O(1) regardless of the rate
+type requestRate struct {
+	window time.Duration
+	counts [rateBuckets]int
+	// slots holds the index of the time slot each bucket is counting
+	slots [rateBuckets]int64
+}
+
+// newRequestRate creates a counter over the given window
+func newRequestRate(window time.Duration) *requestRate {
+	return &requestRate{window: window}
+}
+
+// record counts a request made at now
+func (r *requestRate) record(now time.Time) {
+	slot := r.slot(now)
+	i := slot % rateBuckets
+	if r.slots[i] != slot {
+		r.slots[i] = slot
+		r.counts[i] = 0
+	}
+	r.counts[i]++
+}
+
+// perSecond returns the average number of requests per second over the window
+// ending at now
+func (r *requestRate) perSecond(now time.Time) float64 {
+	current := r.slot(now)
+
+	total := 0
+	for i, slot := range r.slots {
+		if current-slot < rateBuckets {
+			total += r.counts[i]
+		}
+	}
+
+	return float64(total) / r.window.Seconds()
+}
+
+// slot returns the index of the time slot now falls in
+func (r *requestRate) slot(now time.Time) int64 {
+	width := int64(r.window) / rateBuckets
+
+	return now.UnixNano() / max(width, 1)
+}
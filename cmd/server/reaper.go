@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// trackedConn is a connection remembering when it last made progress, i.e.
+// last read or wrote any bytes
+type trackedConn struct {
+	net.Conn
+	lastActivity atomic.Int64
+}
+
+// newTrackedConn wraps conn, counting it as active now
+func newTrackedConn(conn net.Conn) *trackedConn {
+	tracked := &trackedConn{Conn: conn}
+	tracked.touch()
+
+	return tracked
+}
+
+// Read reads from the connection, recording the activity
+func (c *trackedConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.touch()
+	}
+
+	return n, err
+}
+
+// Write writes to the connection, recording the activity
+func (c *trackedConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.touch()
+	}
+
+	return n, err
+}
+
+// touch records activity now
+func (c *trackedConn) touch() {
+	c.lastActivity.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long the connection has been idle at now
+func (c *trackedConn) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, c.lastActivity.Load()))
+}
+
+// connRegistry holds the connections being handled
+type connRegistry struct {
+	mu    sync.Mutex
+	conns map[*trackedConn]struct{}
+}
+
+// newConnRegistry creates an empty registry
+func newConnRegistry() *connRegistry {
+	return &connRegistry{conns: make(map[*trackedConn]struct{})}
+}
+
+// track wraps conn and registers it, returning the function unregistering it
+func (r *connRegistry) track(conn net.Conn) (*trackedConn, func()) {
+	tracked := newTrackedConn(conn)
+
+	r.mu.Lock()
+	r.conns[tracked] = struct{}{}
+	r.mu.Unlock()
+
+	return tracked, func() {
+		r.mu.Lock()
+		delete(r.conns, tracked)
+		r.mu.Unlock()
+	}
+}
+
+// idle returns the connections idle for longer than timeout at now
+func (r *connRegistry) idle(now time.Time, timeout time.Duration) []*trackedConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var idle []*trackedConn
+	for conn := range r.conns {
+		if conn.idleFor(now) > timeout {
+			idle = append(idle, conn)
+		}
+	}
+
+	return idle
+}
+
+// all returns the connections being handled
+func (r *connRegistry) all() []*trackedConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	all := make([]*trackedConn, 0, len(r.conns))
+	for conn := range r.conns {
+		all = append(all, conn)
+	}
+
+	return all
+}
+
+// reapIdleConnections closes connections idle for longer than IdleTimeout
+// until ctx is done. It is a safety net for connections whose deadlines
+// didn't fire, e.g. half-open ones
+func (s *WordOfWisdomServer) reapIdleConnections(ctx context.Context) {
+	defer s.crashOnPanic("idle reaper")
+
+	ticker := time.NewTicker(max(s.config.IdleTimeout/2, time.Millisecond))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, conn := range s.conns.idle(now, s.config.IdleTimeout) {
+				s.logger.Warn("Closing idle connection",
+					zap.String("client", conn.RemoteAddr().String()), zap.Duration("idle", conn.idleFor(now)))
+				_ = conn.Close()
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// halfOpenConn is a connection whose deadlines never fire, like one whose
+// peer vanished without the kernel noticing
+type halfOpenConn struct {
+	net.Conn
+}
+
+func (c halfOpenConn) SetDeadline(time.Time) error      { return nil }
+func (c halfOpenConn) SetReadDeadline(time.Time) error  { return nil }
+func (c halfOpenConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestReaperClosesHalfOpenConnection(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.IdleTimeout = 50 * time.Millisecond
+	s := NewServer(cfg, zap.NewNop())
+
+	serverConn, clientConn := net.Pipe()
+	defer func() { _ = clientConn.Close() }()
+	conn, untrack := s.conns.track(halfOpenConn{Conn: serverConn})
+	defer untrack()
+
+	// The handler waits for a response that never comes
+	if err := conn.SetReadDeadline(time.Now().Add(cfg.IdleTimeout)); err != nil {
+		t.Fatal(err)
+	}
+	readDone := make(chan error, 1)
+	go func() {
+		_, err := conn.Read(make([]byte, 1))
+		readDone <- err
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.reapIdleConnections(ctx)
+
+	select {
+	case err := <-readDone:
+		if err == nil {
+			t.Error("read succeeded on the idle connection")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("half-open connection never reaped")
+	}
+}
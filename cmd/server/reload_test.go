@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/quotes"
+	"go.uber.org/zap"
+)
+
+// writeQuotes atomically replaces the quotes file at path with the quotes
+// named prefix1 to prefix5, so a reload never sees it half written
+func writeQuotes(t *testing.T, path, prefix string) {
+	t.Helper()
+
+	var lines []string
+	for i := 1; i <= 5; i++ {
+		lines = append(lines, fmt.Sprintf("%s%d", prefix, i))
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadQuotesOnSignalWhileServing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	writeQuotes(t, path, "old")
+
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 1
+	cfg.QuotesSource = config.QuotesSourceFile
+	cfg.QuotesFile = path
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+	if err := s.LoadQuotes(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloadQuotesOnSignal(ctx, s)
+
+	// Clients keep fetching quotes while the file is swapped and reloaded.
+	// Connections may be turned away while every worker is busy, the quotes
+	// that are served must all come from either file
+	var wg sync.WaitGroup
+	var served atomic.Int64
+	stop := make(chan struct{})
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				conn, err := listener.Dial(context.Background())
+				if err != nil {
+					t.Error(err)
+
+					return
+				}
+				answer, err := requestQuote(t, s, conn)
+				_ = conn.Close()
+				if errors.Is(err, io.EOF) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+
+					return
+				}
+				served.Add(1)
+
+				quote := strings.TrimPrefix(answer, "Quote:")
+				if !strings.HasPrefix(quote, "old") && !strings.HasPrefix(quote, "new") {
+					t.Errorf("served %q, neither an old nor a new quote", answer)
+				}
+			}
+		}()
+	}
+
+	for i := range 20 {
+		prefix := "old"
+		if i%2 == 0 {
+			prefix = "new"
+		}
+		writeQuotes(t, path, prefix)
+		if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	wg.Wait()
+	if served.Load() == 0 {
+		t.Fatal("no quote served during the reloads")
+	}
+
+	// The last file written, with the new quotes, is served once reloaded
+	writeQuotes(t, path, "new")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for !strings.HasPrefix(s.getRandomQuote(), "new") {
+		if time.Now().After(deadline) {
+			t.Fatal("quotes not reloaded after SIGHUP")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestQuotesOverflowPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	writeQuotes(t, path, "quote")
+
+	for _, policy := range []string{config.QuotesOverflowTruncate, config.QuotesOverflowError} {
+		t.Run(policy, func(t *testing.T) {
+			cfg := testServerConfig()
+			cfg.QuotesSource = config.QuotesSourceFile
+			cfg.QuotesFile = path
+			cfg.MaxQuotes = 3
+			cfg.QuotesOverflowPolicy = policy
+			s := NewServer(cfg, zap.NewNop())
+
+			err := s.LoadQuotes()
+			if policy == config.QuotesOverflowError {
+				if !errors.Is(err, quotes.ErrTooManyQuotes) {
+					t.Fatalf("loaded with %v, want ErrTooManyQuotes", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded := s.quotes.Load().quotes; strings.Join(loaded, ",") != "quote1,quote2,quote3" {
+				t.Fatalf("loaded %q, want the first 3 quotes", loaded)
+			}
+		})
+	}
+}
+
+func TestWeightedQuoteSelection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	if err := os.WriteFile(path, []byte("9|heavy\n1|light\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := testServerConfig()
+	cfg.QuotesSource = config.QuotesSourceFile
+	cfg.QuotesFile = path
+	s := NewServer(cfg, zap.NewNop())
+	if err := s.LoadQuotes(); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for range 2000 {
+		counts[s.getRandomQuote()]++
+	}
+
+	// 1800 against 200 expected, far more than chance would skew it
+	if counts["light"] == 0 || counts["heavy"] < 5*counts["light"] {
+		t.Errorf("picked %v, want heavy about 9 times as often as light", counts)
+	}
+}
+
+func TestQuoteBucketStable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotes.txt")
+	writeQuotes(t, path, "quote")
+	cfg := testServerConfig()
+	cfg.QuotesSource = config.QuotesSourceFile
+	cfg.QuotesFile = path
+
+	// Everyone within a bucket gets the same quote
+	cfg.QuoteBucket = time.Hour
+	s := NewServer(cfg, zap.NewNop())
+	if err := s.LoadQuotes(); err != nil {
+		t.Fatal(err)
+	}
+	first := s.getRandomQuote()
+	for range 20 {
+		if quote := s.getRandomQuote(); quote != first {
+			t.Fatalf("got %q and %q within one bucket", first, quote)
+		}
+	}
+
+	// Buckets that come and go during the test pick from all the quotes
+	cfg.QuoteBucket = 20 * time.Millisecond
+	s = NewServer(cfg, zap.NewNop())
+	if err := s.LoadQuotes(); err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for range 10 {
+		seen[s.getRandomQuote()] = true
+		time.Sleep(cfg.QuoteBucket)
+	}
+	if len(seen) < 2 {
+		t.Errorf("got only %v across 10 buckets", seen)
+	}
+}
+
+func TestEmbeddedQuotesSource(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.QuotesSource = config.QuotesSourceEmbedded
+	// No file is read with the embedded source
+	cfg.QuotesFile = filepath.Join(t.TempDir(), "missing.txt")
+	s := NewServer(cfg, zap.NewNop())
+	if err := s.LoadQuotes(); err != nil {
+		t.Fatal(err)
+	}
+
+	embedded, _, err := quotes.Embedded(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embedded) == 0 {
+		t.Fatal("no quotes embedded")
+	}
+	if loaded := s.quotes.Load().quotes; strings.Join(loaded, "\n") != strings.Join(embedded, "\n") {
+		t.Errorf("loaded %d quotes, want the %d embedded ones", len(loaded), len(embedded))
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/logfile"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/recording"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestReopenOnSignalReopensEverySink(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "server.log")
+	recordPath := filepath.Join(dir, "solutions.jsonl")
+	replayPath := filepath.Join(dir, "replay.log")
+
+	logFile, err := logfile.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = logFile.Close() }()
+	recorder, err := recording.Open(recordPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = recorder.Close() }()
+	store, err := replay.OpenFileStore(replayPath, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	issued := replay.Challenge{Timestamp: time.Now(), Difficulty: 1}
+	if err := store.Issue("before", issued); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	core, logs := observer.New(zap.InfoLevel)
+	reopenOnSignal(ctx, zap.New(core), logFile, recorder, store)
+
+	// Rotate every file away, as logrotate does, and ask for a reopen
+	for _, path := range []string{logPath, recordPath, replayPath} {
+		if err := os.Rename(path, path+".1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("Reopened file").Len() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sinks not reopened after SIGUSR1: %v", logs.All())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := logFile.Write([]byte("after\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Record(recording.Solution{Challenge: "after"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := os.ReadFile(logPath); err != nil || string(data) != "after\n" {
+		t.Errorf("log file holds %q, %v; want only the line written after rotation", data, err)
+	}
+	solutions, err := recording.Read(recordPath)
+	if err != nil || len(solutions) != 1 || solutions[0].Challenge != "after" {
+		t.Errorf("recording holds %+v, %v; want only the solution recorded after rotation", solutions, err)
+	}
+	if _, ok, err := store.Take("before"); !ok || err != nil {
+		t.Errorf("challenge issued before rotation: ok %t, err %v", ok, err)
+	}
+}
@@ -1,90 +1,356 @@
 package main
 
 import (
-	"crypto/sha256"
+	"bufio"
+	"context"
+	cryptorand "crypto/rand"
 	"encoding/hex"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/logfile"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/protocol"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/quotes"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/recording"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 const (
-	letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	letters         = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	challengeLength = 64
 
-	maxDifficultyClientCount = 50
-	minDifficultyClientCount = 20
+	// pingMessage and pongMessage are the keep-alive messages
+	pingMessage = "Ping"
+	pongMessage = "Pong"
+
+	// maxOutstandingChallenges bounds the issued challenges awaiting a solution
+	maxOutstandingChallenges = 10000
+
+	// maxSoftwareLength bounds the client software identifier that is logged
+	maxSoftwareLength = 64
 )
 
 var (
-	runes = []rune(letters)
+	errMalformedResponse = errors.New("malformed response")
 )
 
+// builtinQuotes are served unless quotes are loaded from elsewhere
+var builtinQuotes = []string{
+	"The only true wisdom is in knowing you know nothing. - Socrates",
+	"The journey of a thousand miles begins with one step. - Lao Tzu",
+	"That which does not kill us makes us stronger. - Friedrich Nietzsche",
+	"Life is what happens when you’re busy making other plans. - John Lennon",
+	"When the going gets tough, the tough get going. - Joe Kennedy",
+}
+
+// quoteSet is a set of quotes along with the running totals of their
+// weights, nil when quotes are picked uniformly. It is never modified once
+// published, so that it can be swapped while being read
+type quoteSet struct {
+	quotes  []string
+	weights []float64
+}
+
 // WordOfWisdomServer is a server that serves word of wisdom requests
 type WordOfWisdomServer struct {
 	config     config.ServerConfig
 	listener   net.Listener
-	quotes     []string
 	clientLoad int
 	mu         sync.Mutex
 	logger     *zap.Logger
+	// ipLoad counts the active connections per client IP
+	ipLoad map[string]int
+	// random is the source of randomness for challenges
+	random io.Reader
+	// replay tracks the issued challenges so each is solved only once
+	replay replay.Store
+
+	// loadSource, when set, provides the load aggregated across instances;
+	// sharedLoad is its last reading, taken at sharedLoadAt
+	loadSource   LoadSource
+	sharedLoad   int
+	sharedLoadAt time.Time
+
+	// difficulty is the currently advertised difficulty; pendingDifficulty and
+	// pendingSamples track a change that hasn't yet passed the hysteresis
+	difficulty        int
+	pendingDifficulty int
+	pendingSamples    int
+	// requestRate counts the challenges issued, feeding the rate metric
+	requestRate *requestRate
+
+	// recorder, when set, records every verified solution
+	recorder *recording.Recorder
+	// layout assembles the hashed data, pow.CanonicalLayout when nil
+	layout pow.DataLayout
+	// verify checks a solution, verifyPoW unless a costlier scheme is
+	// plugged in; it must give up once ctx is done
+	verify verifyFunc
+
+	// preset holds the difficulty settings in effect, switched at runtime by
+	// UsePreset; presetName is empty for the top-level settings
+	preset     config.Preset
+	presetName string
+
+	// conns holds the connections being handled
+	conns *connRegistry
+
+	// difficultyCeiling caps the advertised difficulty, 0 when there is no
+	// SLA to honor
+	difficultyCeiling int
+
+	// stats counts the outcomes of challenges for Stats
+	stats statsCounters
+
+	// lastAccept is when a connection was last accepted, in Unix
+	// nanoseconds, watched when AcceptWatchdogInterval is set
+	lastAccept atomic.Int64
+	// accepting is set while the accept loop waits in Accept, and
+	// acceptFailures counts the failed Accept calls since the watchdog last
+	// looked
+	accepting      atomic.Bool
+	acceptFailures atomic.Int64
+	// connIDs numbers the connections in their summaries
+	connIDs atomic.Uint64
+	// quotes holds the quotes being served, swapped as a whole on reload
+	quotes atomic.Pointer[quoteSet]
+	// draining is set once Shutdown was called, after which no challenge is
+	// issued
+	draining atomic.Bool
+	// shutdown is closed along with setting draining, waking up whatever
+	// waits on the server
+	shutdown chan struct{}
+	// ready is closed once Serve's workers wait for connections
+	ready chan struct{}
+	// debugNets are the networks of DebugFilter
+	debugNets []*net.IPNet
 }
 
+// verifyFunc checks a solution to an issued challenge, returning why it is
+// invalid
+type verifyFunc func(ctx context.Context, challenge string, issued replay.Challenge, nonce string, clientTimestamp time.Time, logger *zap.Logger) error
+
 // NewServer initializes a new server with the given configuration and logger
 func NewServer(cfg config.ServerConfig, logger *zap.Logger) *WordOfWisdomServer {
-	return &WordOfWisdomServer{
-		config: cfg,
-		quotes: []string{
-			"The only true wisdom is in knowing you know nothing. - Socrates",
-			"The journey of a thousand miles begins with one step. - Lao Tzu",
-			"That which does not kill us makes us stronger. - Friedrich Nietzsche",
-			"Life is what happens when you’re busy making other plans. - John Lennon",
-			"When the going gets tough, the tough get going. - Joe Kennedy",
-		},
-		logger: logger,
+	// Configs built in code skip LoadConfig, whose defaults the server relies on
+	cfg.ApplyDefaults()
+	preset := initialPreset(cfg)
+
+	s := &WordOfWisdomServer{
+		config:      cfg,
+		ipLoad:      make(map[string]int),
+		logger:      logger,
+		random:      cryptorand.Reader,
+		replay:      replay.NewMemoryStore(replayTTL(cfg), maxOutstandingChallenges),
+		difficulty:  preset.MinDifficulty,
+		requestRate: newRequestRate(cfg.RateWindow),
+		preset:      preset,
+		presetName:  cfg.Preset,
+		conns:       newConnRegistry(),
+		debugNets:   parseDebugFilter(cfg.DebugFilter),
+		ready:       make(chan struct{}),
+		shutdown:    make(chan struct{}),
 	}
+	s.quotes.Store(&quoteSet{quotes: builtinQuotes})
+	s.verify = s.verifyPoW
+
+	return s
+}
+
+// Ready is closed once Serve accepts connections; connections accepted
+// before then may be turned away as if every worker were busy
+func (s *WordOfWisdomServer) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// UseReplayStore replaces the in-memory replay store, e.g. with one that
+// survives restarts
+func (s *WordOfWisdomServer) UseReplayStore(store replay.Store) {
+	s.replay = store
+}
+
+// UseRecorder makes the server record every verified solution
+func (s *WordOfWisdomServer) UseRecorder(recorder *recording.Recorder) {
+	s.recorder = recorder
 }
 
-// Start launches the server and begins accepting connections
+// UseDataLayout makes the server verify solutions hashed with the given
+// layout instead of the canonical one; clients must use the same
+func (s *WordOfWisdomServer) UseDataLayout(layout pow.DataLayout) {
+	s.layout = layout
+}
+
+// LoadQuotes replaces the quotes with the ones from the configured quotes
+// file, or with the embedded ones when QuotesSource is embedded
+func (s *WordOfWisdomServer) LoadQuotes() error {
+	var (
+		loaded  []string
+		weights []float64
+		err     error
+	)
+	source := s.config.QuotesFile
+	if s.config.QuotesSource == config.QuotesSourceEmbedded {
+		source = config.QuotesSourceEmbedded
+		loaded, weights, err = quotes.Embedded(s.config.MaxQuotes)
+	} else {
+		loaded, weights, err = quotes.Load(s.config.QuotesFile, s.config.MaxQuotes)
+	}
+	if errors.Is(err, quotes.ErrTooManyQuotes) && s.config.QuotesOverflowPolicy != config.QuotesOverflowError {
+		s.logger.Warn("Quotes file truncated", zap.Int("max_quotes", s.config.MaxQuotes), zap.Error(err))
+	} else if err != nil {
+		return err
+	}
+
+	s.quotes.Store(&quoteSet{quotes: loaded, weights: cumulativeWeights(weights)})
+	s.logger.Info("Quotes loaded",
+		zap.String("source", source),
+		zap.Int("count", len(loaded)),
+		zap.Bool("weighted", weights != nil),
+	)
+
+	return nil
+}
+
+// Start listens on the configured address and begins accepting connections
 func (s *WordOfWisdomServer) Start() error {
 	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-	listener, err := net.Listen("tcp", addr)
+	listener, err := s.listen(addr)
 	if err != nil {
 		return fmt.Errorf("failed to start server: %w", err)
 	}
+	s.logger.Info("Server started", zap.String("address", addr), zap.Object("config", s.config))
+
+	return s.Serve(listener)
+}
+
+// listen binds addr, retrying up to ListenRetries times after
+// ListenRetryDelay while the address is in use, e.g. by an instance that is
+// still shutting down
+func (s *WordOfWisdomServer) listen(addr string) (net.Listener, error) {
+	for attempt := 0; ; attempt++ {
+		listener, err := net.Listen("tcp", addr)
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return listener, err
+		}
+
+		if attempt >= s.config.ListenRetries {
+			return nil, fmt.Errorf("port %d already in use, is another instance running? %w", s.config.Port, err)
+		}
+
+		s.logger.Warn("Address in use, retrying", zap.String("address", addr), zap.Int("attempt", attempt+1))
+		time.Sleep(s.config.ListenRetryDelay)
+	}
+}
+
+// Serve accepts and handles connections from the given listener until it is closed
+func (s *WordOfWisdomServer) Serve(listener net.Listener) error {
+	defer s.crashOnPanic("accept loop")
+
+	s.mu.Lock()
 	s.listener = listener
-	s.logger.Info("Server started", zap.String("address", addr))
+	s.mu.Unlock()
 
-	var wg sync.WaitGroup
+	if s.config.SLAMaxSolveTime > 0 {
+		s.calibrateDifficultyCeiling()
+	}
+
+	if s.config.Honeypot {
+		s.logger.Warn("Honeypot mode enabled, proof of work is NOT enforced: every client is served a quote")
+	}
+
+	if s.config.HTTPAddress != "" {
+		httpServer := s.startHTTPGateway()
+		defer func() {
+			_ = httpServer.Close()
+		}()
+	}
+
+	if s.config.AdminAddress != "" {
+		adminServer := s.startAdminServer()
+		defer func() {
+			_ = adminServer.Close()
+		}()
+	}
+
+	if s.loadSource != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go s.pollLoadSource(ctx)
+	}
+
+	if s.config.IdleTimeout > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go s.reapIdleConnections(ctx)
+	}
+
+	if s.config.AcceptWatchdogInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go s.watchAccepts(ctx)
+	}
+
+	if s.config.StatsDAddress != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		go s.pushStatsD(ctx)
+	}
+
+	var wg, started sync.WaitGroup
 	connectionChan := make(chan net.Conn)
 
 	for i := 0; i < s.config.MaxConnections; i++ {
 		wg.Add(1)
+		started.Add(1)
 		go func() {
 			defer wg.Done()
+			started.Done()
 			for conn := range connectionChan {
 				s.handleConnection(conn)
 			}
 		}()
 	}
+	started.Wait()
+	close(s.ready)
 
 	for {
+		s.accepting.Store(true)
 		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			break
+		}
+		s.accepting.Store(false)
 		if err != nil {
-			if errors.Is(err, net.ErrClosed) {
-				break
-			}
+			s.acceptFailures.Add(1)
 			s.logger.Error("Error accepting connection", zap.Error(err))
 
 			continue
 		}
+		s.markAccepted()
+
 		select {
 		case connectionChan <- conn:
 		default:
@@ -97,55 +363,331 @@ func (s *WordOfWisdomServer) Start() error {
 	}
 
 	close(connectionChan)
-	wg.Wait()
+	s.drain(&wg)
 
 	return nil
 }
 
+// startHTTPGateway serves the HTTP gateway in the background
+func (s *WordOfWisdomServer) startHTTPGateway() *http.Server {
+	httpServer := &http.Server{
+		Addr:              s.config.HTTPAddress,
+		Handler:           newHTTPGateway(s).handler(),
+		ReadHeaderTimeout: s.config.ConnectionTimeout,
+		ErrorLog:          zap.NewStdLog(s.logger),
+	}
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("HTTP gateway error", zap.Error(err))
+		}
+	}()
+	s.logger.Info("HTTP gateway started", zap.String("address", s.config.HTTPAddress))
+
+	return httpServer
+}
+
 // handleConnection processes a single client connection
 func (s *WordOfWisdomServer) handleConnection(conn net.Conn) {
 	defer func() {
 		_ = conn.Close()
 	}()
+	defer s.recoverConnection(conn.RemoteAddr().String())
+
+	tracked, untrack := s.conns.track(conn)
+	defer untrack()
+	conn = tracked
+
+	logger := s.connLogger(conn)
+
+	summary, conn := s.newConnSummary(conn)
+	defer summary.log(logger)
 
 	clientAddr := conn.RemoteAddr().String()
-	s.logger.Info("Accepted connection", zap.String("client", clientAddr))
+	logger.Info("Accepted connection", zap.String("client", clientAddr))
 
 	s.incrementClientLoad()
 	defer s.decrementClientLoad()
 
+	clientIP := remoteIP(conn)
+	if !s.acquireIPSlot(clientIP) {
+		s.sendError(conn, protocol.CodeLimit, "Too many concurrent connections.")
+		logger.Warn("Too many concurrent connections from client", zap.String("client", clientAddr))
+		summary.end(outcomeLimited, nil)
+
+		return
+	}
+	defer s.releaseIPSlot(clientIP)
+
+	// Identify the protocol to sniffing tools and middleboxes
+	if s.config.Banner != "" {
+		if _, err := conn.Write([]byte(s.config.Banner + "\n")); err != nil {
+			logger.Error("Failed to send banner", zap.String("client", clientAddr), zap.Error(err))
+			summary.end(outcomeWriteFailed, err)
+
+			return
+		}
+	}
+
+	// Lines are told apart by the state they arrived in, so the connection
+	// is read in the background from now on
+	if s.config.StrictOrdering {
+		conn = newOrderedConn(conn, s.config.ReadBufferBytes)
+	}
+
+	reader := bufio.NewReaderSize(conn, s.config.ReadBufferBytes)
+
+	// Trusted clients are served without a challenge
+	identity, ok, err := s.authenticate(conn, reader, logger)
+	if err != nil {
+		logger.Error("Failed to receive authentication", zap.String("client", clientAddr), zap.Error(err))
+		if errors.Is(err, errMalformedResponse) {
+			s.rejectMalformedResponse(conn)
+		}
+		summary.end(outcomeNoResponse, err)
+
+		return
+	}
+	if ok {
+		if err := s.sendQuote(conn, s.getRandomQuote(), time.Time{}); err != nil {
+			logger.Error("Failed to send quote", zap.String("client", clientAddr), zap.Error(err))
+			summary.end(outcomeWriteFailed, err)
+		} else {
+			logger.Info("Quote sent to authenticated client", zap.String("client", clientAddr), zap.String("identity", identity))
+			summary.served(outcomeAuthenticated)
+		}
+
+		return
+	}
+
+	s.delayChallenge()
+
+	// Clients asking for more get the next challenge right after their quote
+	next := s.serveChallenge(conn, reader, clientAddr, logger, summary)
+	for chained := 0; next && chained < s.config.MaxChainedChallenges; chained++ {
+		next = s.serveChallenge(conn, reader, clientAddr, logger, summary)
+	}
+}
+
+// serveChallenge issues a challenge and serves a quote for its solution,
+// reporting whether the client asked for another challenge
+func (s *WordOfWisdomServer) serveChallenge(conn net.Conn, reader *bufio.Reader, clientAddr string, logger *zap.Logger, summary *connSummary) bool {
+	timer := newPhaseTimer(s.config.LogTimings)
+	defer timer.log(logger, clientAddr)
+
+	// Challenges already issued may still be solved while shutting down, but
+	// no new ones are
+	if s.draining.Load() {
+		s.sendError(conn, protocol.CodeBusy, "Server shutting down.")
+		summary.end(outcomeBusy, nil)
+
+		return false
+	}
+
 	// Generate challenge and difficulty
 	difficulty := s.adjustDifficulty()
-	challenge := s.generateChallenge()
+	challenge, err := s.generateChallenge()
+	if err != nil {
+		logger.Error("Failed to generate challenge", zap.String("client", clientAddr), zap.Error(err))
+		s.sendError(conn, protocol.CodeInternal, "Internal server error.")
+		summary.end(outcomeInternalError, err)
+
+		return false
+	}
 	serverTimestamp := time.Now().UTC()
+	issued := replay.Challenge{Timestamp: serverTimestamp, Difficulty: difficulty, Purpose: s.config.Purpose}
+
+	if err = s.replay.Issue(challenge, issued); err != nil {
+		logger.Error("Failed to record challenge", zap.String("client", clientAddr), zap.Error(err))
+		s.sendError(conn, protocol.CodeBusy, "Server busy.")
+		summary.end(outcomeBusy, err)
+
+		return false
+	}
+	s.stats.challengeIssued()
+	summary.challenge(difficulty)
+	timer.mark("generate")
+
+	// Responses are only expected once the challenge is out
+	if ordered, ok := conn.(*orderedConn); ok {
+		if err = ordered.beginChallenge(); err != nil {
+			logger.Warn("Unexpected input before challenge", zap.String("client", clientAddr), zap.Error(err))
+			s.sendError(conn, protocol.CodeMalformed, "Response sent before the challenge.")
+			summary.end(outcomeOutOfOrder, err)
+
+			return false
+		}
+	}
 
 	// Send challenge to client
-	if err := s.sendChallenge(conn, challenge, serverTimestamp, difficulty); err != nil {
-		s.logger.Error("Failed to send challenge", zap.String("client", clientAddr), zap.Error(err))
+	if err = s.sendChallenge(conn, challenge, issued); err != nil {
+		logger.Error("Failed to send challenge", zap.String("client", clientAddr), zap.Error(err))
+		summary.end(outcomeWriteFailed, err)
 
-		return
+		return false
 	}
+	timer.mark("send_challenge")
+	logger.Debug("Challenge sent", zap.String("client", clientAddr), zap.String("challenge", challenge),
+		zap.Time("timestamp", serverTimestamp), zap.Int("difficulty", difficulty), zap.String("purpose", issued.Purpose))
 
 	// Receive PoW response from client
-	nonce, clientTimestamp, err := s.receiveResponse(conn)
+	response, err := s.receiveResponse(conn, reader, issued, logger)
 	if err != nil {
-		s.logger.Error("Failed to receive response", zap.String("client", clientAddr), zap.Error(err))
+		logger.Error("Failed to receive response", zap.String("client", clientAddr), zap.Error(err))
+		if errors.Is(err, errMalformedResponse) {
+			s.rejectMalformedResponse(conn)
+		}
+		summary.end(outcomeNoResponse, err)
 
-		return
+		return false
+	}
+	timer.mark("wait_response")
+	logger.Debug("Response received", zap.String("client", clientAddr), zap.String("nonce", response.nonce),
+		zap.Time("client_timestamp", response.timestamp), zap.String("challenge", response.challenge),
+		zap.Int("attempts", response.attempts), zap.Bool("next", response.next), zap.Bool("subscribe", response.subscribe))
+	summary.solved(time.Since(serverTimestamp))
+	if response.software != "" {
+		logger.Info("Client software", zap.String("client", clientAddr), zap.String("software", response.software))
 	}
 
-	// Verify Proof of Work using the original serverTimestamp
-	if s.verifyPoW(challenge, nonce, clientTimestamp, serverTimestamp, difficulty) {
+	// The response must be for the challenge we issued before it is hashed;
+	// in honeypot mode a rejected response is served all the same
+	rejection := s.checkResponse(challenge, issued, response)
+	var reason error
+	if rejection != nil {
+		reason = rejection.reason
+	} else {
+		// Verify Proof of Work using the original serverTimestamp
+		reason = s.checkSolution(challenge, issued, response.nonce, response.timestamp, clientAddr, logger)
+		timer.mark("verify")
+		logger.Debug("Solution checked", zap.String("client", clientAddr), zap.Error(reason))
+	}
+	if s.acceptSolution(reason == nil, clientAddr, logger) {
 		quote := s.getRandomQuote()
-		if err := s.sendQuote(conn, quote); err != nil {
-			s.logger.Error("Failed to send quote", zap.String("client", clientAddr), zap.Error(err))
-		} else {
-			s.logger.Info("Quote sent successfully", zap.String("client", clientAddr))
+		if err := s.sendQuote(conn, quote, time.Time{}); err != nil {
+			logger.Error("Failed to send quote", zap.String("client", clientAddr), zap.Error(err))
+			summary.end(outcomeWriteFailed, err)
+
+			return false
 		}
-	} else {
-		s.sendError(conn, "Invalid proof of work.")
-		s.logger.Warn("Invalid PoW attempt", zap.String("client", clientAddr))
+		timer.mark("send_quote")
+		summary.served(outcomeServed)
+		s.stats.solutionAccepted(quote)
+		logger.Info("Quote sent successfully", zap.String("client", clientAddr),
+			zap.Int("difficulty", difficulty),
+			zap.Float64("expected_attempts", pow.ExpectedAttempts(difficulty)),
+			zap.Int("reported_attempts", response.attempts),
+		)
+
+		if response.subscribe && s.config.SubscriptionInterval > 0 {
+			s.streamQuotes(conn, reader, clientAddr, logger)
+
+			return false
+		}
+
+		return response.next
+	}
+
+	s.stats.solutionRejected()
+	if rejection != nil {
+		s.sendError(conn, rejection.code, rejection.message)
+		logger.Warn(rejection.logMessage, zap.String("client", clientAddr), zap.Error(reason))
+		summary.end(rejection.outcome, reason)
+
+		return false
+	}
+
+	code := s.rejectionCode(issued)
+	s.sendError(conn, code, s.rejectionMessage(reason))
+	logger.Warn("Invalid PoW attempt", zap.String("client", clientAddr), zap.String("code", code), zap.Error(reason))
+	summary.end(outcomeRejected, reason)
+
+	return false
+}
+
+// responseRejection is why a response is turned down before its solution is
+// hashed, along with what the client, the log and the summary are told
+type responseRejection struct {
+	reason     error
+	code       string
+	message    string
+	logMessage string
+	outcome    string
+}
+
+// checkResponse checks that a response echoes the challenge and purpose that
+// were issued and takes the challenge, so that it is solved only once while
+// it is fresh. It returns nil when the solution is to be hashed
+func (s *WordOfWisdomServer) checkResponse(challenge string, issued replay.Challenge, response clientResponse) *responseRejection {
+	// Make sure the client solved the challenge we issued before hashing
+	if s.config.RequireChallengeEcho && response.challenge != challenge {
+		return &responseRejection{
+			reason:     fmt.Errorf("echoed challenge %q was not issued", response.challenge),
+			code:       protocol.CodeMismatch,
+			message:    "Challenge mismatch.",
+			logMessage: "Echoed challenge mismatch",
+			outcome:    outcomeMismatch,
+		}
+	}
+
+	// A solution is only good for the purpose the challenge was issued for
+	if response.purpose != issued.Purpose {
+		return &responseRejection{
+			reason:     fmt.Errorf("echoed purpose %q, issued for %q", response.purpose, issued.Purpose),
+			code:       protocol.CodeMismatch,
+			message:    "Purpose mismatch.",
+			logMessage: "Echoed purpose mismatch",
+			outcome:    outcomeMismatch,
+		}
+	}
+
+	_, rejection := s.takeChallenge(challenge)
+
+	return rejection
+}
+
+// takeChallenge takes a challenge from the replay store, so that it is solved
+// only once while it is fresh. The rejection tells a challenge solved before
+// from one unknown or expired
+func (s *WordOfWisdomServer) takeChallenge(challenge string) (replay.Challenge, *responseRejection) {
+	issued, ok, err := s.replay.Take(challenge)
+	if ok {
+		return issued, nil
+	}
+
+	if errors.Is(err, replay.ErrSpent) {
+		return issued, &responseRejection{
+			reason:     err,
+			code:       protocol.CodeReused,
+			message:    "Challenge already solved.",
+			logMessage: "Spent challenge submitted again",
+			outcome:    outcomeReused,
+		}
+	}
+	if err == nil {
+		err = errors.New("challenge unknown or expired")
+	}
+
+	return issued, &responseRejection{
+		reason:     err,
+		code:       protocol.CodeExpired,
+		message:    "Unknown or expired challenge.",
+		logMessage: "Challenge not outstanding",
+		outcome:    outcomeExpired,
+	}
+}
+
+// acceptSolution decides whether a verified solution earns a quote. In
+// honeypot mode every solution does and only its validity is logged
+func (s *WordOfWisdomServer) acceptSolution(valid bool, clientAddr string, logger *zap.Logger) bool {
+	if !s.config.Honeypot {
+		return valid
 	}
+
+	logger.Warn("Honeypot mode, serving quote regardless of PoW",
+		zap.String("client", clientAddr), zap.Bool("valid_pow", valid))
+
+	return true
 }
 
 // incrementClientLoad increases the active client count
@@ -164,119 +706,506 @@ func (s *WordOfWisdomServer) decrementClientLoad() {
 	s.clientLoad--
 }
 
-// adjustDifficulty dynamically adjusts difficulty based on load
+// acquireIPSlot counts a new connection from ip, reporting false without
+// counting it when ip already holds MaxConcurrentPerIP connections
+func (s *WordOfWisdomServer) acquireIPSlot(ip string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config.MaxConcurrentPerIP > 0 && s.ipLoad[ip] >= s.config.MaxConcurrentPerIP {
+		return false
+	}
+	s.ipLoad[ip]++
+
+	return true
+}
+
+// releaseIPSlot uncounts a connection from ip
+func (s *WordOfWisdomServer) releaseIPSlot(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ipLoad[ip]--
+	if s.ipLoad[ip] <= 0 {
+		delete(s.ipLoad, ip)
+	}
+}
+
+// remoteIP returns the IP the connection comes from, or its whole remote
+// address when it has no port
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// adjustDifficulty dynamically adjusts difficulty based on load. Every call
+// counts as a request for the rate metric and is treated as a load sample:
+// the difficulty is raised once the load exceeds a threshold and lowered only
+// once it drops HysteresisMargin below it, in both cases for HysteresisSamples
+// consecutive samples, so a load hovering around a threshold doesn't make the
+// difficulty flap. With MaxDifficultyStep set, the difficulty changes by at
+// most that much per adjustment
 func (s *WordOfWisdomServer) adjustDifficulty() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.clientLoad > maxDifficultyClientCount {
-		return s.config.MaxDifficulty
-	} else if s.clientLoad > minDifficultyClientCount {
-		return s.config.MaxDifficulty - 1
+	s.requestRate.record(time.Now())
+	load := s.currentLoad()
+
+	target := s.difficulty
+	if raise := s.difficultyForLoad(load, 0); raise > s.difficulty {
+		target = raise
+	} else if lower := s.difficultyForLoad(load, s.config.HysteresisMargin); lower < s.difficulty {
+		target = lower
+	}
+
+	// A load spike moves the difficulty one step per adjustment at most
+	if step := s.config.MaxDifficultyStep; step > 0 {
+		target = min(max(target, s.difficulty-step), s.difficulty+step)
 	}
 
-	return s.config.MinDifficulty
+	if target == s.difficulty {
+		s.pendingSamples = 0
+
+		return s.difficulty
+	}
+
+	if target != s.pendingDifficulty {
+		s.pendingDifficulty = target
+		s.pendingSamples = 0
+	}
+	s.pendingSamples++
+
+	if s.pendingSamples >= s.config.HysteresisSamples {
+		s.logger.Info("Difficulty changed",
+			zap.Int("from", s.difficulty), zap.Int("to", target), zap.Int("load", load))
+		s.difficulty = target
+		s.pendingSamples = 0
+	}
+
+	return s.difficulty
 }
 
-// generateChallenge creates a unique challenge string
-func (s *WordOfWisdomServer) generateChallenge() string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+// difficultyForLoad maps the load to a difficulty level within the preset's
+// range, with the load thresholds lowered by margin
+func (s *WordOfWisdomServer) difficultyForLoad(load, margin int) int {
+	if load > s.config.MaxDifficultyLoad-margin {
+		return s.capDifficulty(s.preset.MaxDifficulty)
+	} else if load > s.config.MidDifficultyLoad-margin {
+		// With min_difficulty == max_difficulty there is no step below the top
+		return s.capDifficulty(max(s.preset.MaxDifficulty-1, s.preset.MinDifficulty))
+	}
 
-	b := make([]rune, 64)
-	for i := range b {
-		b[i] = runes[r.Intn(len(runes))]
+	return s.capDifficulty(s.preset.MinDifficulty)
+}
+
+// delayChallenge waits a random time up to ChallengeSendJitter, so that a
+// burst of clients doesn't solve and respond all at once. Shutting down cuts
+// the wait short
+func (s *WordOfWisdomServer) delayChallenge() {
+	if s.config.ChallengeSendJitter <= 0 {
+		return
 	}
 
-	return string(b)
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(s.config.ChallengeSendJitter))))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-s.shutdown:
+	}
+}
+
+// generateChallenge creates a unique challenge string from the server's
+// source of cryptographic randomness, prefixed with the namespace if any
+func (s *WordOfWisdomServer) generateChallenge() (string, error) {
+	// Bytes at or above limit are skipped, as they would bias the modulo
+	limit := len(letters) * (256 / len(letters))
+
+	challenge := make([]byte, 0, challengeLength)
+	buffer := make([]byte, challengeLength)
+	for len(challenge) < challengeLength {
+		if _, err := io.ReadFull(s.random, buffer); err != nil {
+			return "", fmt.Errorf("failed to read random bytes: %w", err)
+		}
+
+		for _, b := range buffer {
+			if int(b) < limit && len(challenge) < challengeLength {
+				challenge = append(challenge, letters[int(b)%len(letters)])
+			}
+		}
+	}
+
+	return s.namespacePrefix() + string(challenge), nil
+}
+
+// namespacePrefix is what starts every challenge issued in the configured
+// namespace, it is empty without one
+func (s *WordOfWisdomServer) namespacePrefix() string {
+	if s.config.ChallengeNamespace == "" {
+		return ""
+	}
+
+	return s.config.ChallengeNamespace + "."
 }
 
 // sendChallenge sends the PoW challenge to the client
-func (s *WordOfWisdomServer) sendChallenge(conn net.Conn, challenge string, timestamp time.Time, difficulty int) error {
-	message := fmt.Sprintf("Challenge:%s;Timestamp:%s;Difficulty:%d\n",
-		challenge, timestamp.Format(time.RFC3339Nano), difficulty)
+func (s *WordOfWisdomServer) sendChallenge(conn net.Conn, challenge string, issued replay.Challenge) error {
+	message := fmt.Sprintf("Challenge:%s;Timestamp:%s;Difficulty:%d",
+		challenge, pow.CanonicalTimestamp(issued.Timestamp), issued.Difficulty)
+	if issued.Purpose != "" {
+		message += ";Purpose:" + issued.Purpose
+	}
+	if encoding := s.nonceEncoding(); encoding != pow.NonceDecimal {
+		message += ";NonceEncoding:" + string(encoding)
+	}
+	message += "\n"
 
 	_, err := conn.Write([]byte(message))
 
 	return err
 }
 
-// receiveResponse reads the client's PoW solution
-func (s *WordOfWisdomServer) receiveResponse(conn net.Conn) (string, time.Time, error) {
-	buffer := make([]byte, 4096)
+// clientResponse is the client's PoW solution
+type clientResponse struct {
+	nonce     string
+	timestamp time.Time
+	// challenge is the challenge echoed back by the client, if any
+	challenge string
+	// attempts is the number of hashes the client reports having computed,
+	// it is 0 when not reported
+	attempts int
+	// next is set when the client asks for another challenge after the quote
+	next bool
+	// subscribe is set when the client asks for quotes pushed periodically
+	// after the quote
+	subscribe bool
+	// purpose is the purpose echoed back by the client, if any
+	purpose string
+	// software identifies the client software, if the client says; it is
+	// only logged, truncated to maxSoftwareLength
+	software string
+}
+
+// receiveResponse reads the client's PoW solution. With keep-alive enabled,
+// every ping is answered with a pong and restarts the read deadline, though
+// never past the end of the challenge's time window
+func (s *WordOfWisdomServer) receiveResponse(conn net.Conn, reader *bufio.Reader, issued replay.Challenge, logger *zap.Logger) (clientResponse, error) {
+	expiresAt := issued.Timestamp.Add(s.timeWindow(issued.Difficulty))
+	connectionTimeout := s.limits().ConnectionTimeout
 
-	if err := conn.SetReadDeadline(time.Now().Add(s.config.ConnectionTimeout)); err != nil {
-		s.logger.Error("set read deadline failed", zap.Error(err))
+	for {
+		deadline := time.Now().Add(connectionTimeout)
+		if s.config.KeepAlive && deadline.After(expiresAt) {
+			deadline = expiresAt
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			logger.Error("set read deadline failed", zap.Error(err))
+		}
+
+		response, err := readMessage(reader)
+		if err != nil {
+			return clientResponse{}, err
+		}
+
+		// Clients with a token send it whether or not the server takes tokens
+		if strings.HasPrefix(response, authPrefix) {
+			continue
+		}
+
+		if s.config.KeepAlive && response == pingMessage {
+			if _, err := conn.Write([]byte(pongMessage + "\n")); err != nil {
+				return clientResponse{}, err
+			}
+
+			continue
+		}
+
+		return s.parseResponse(response)
 	}
+}
 
-	n, err := conn.Read(buffer)
+// readMessage reads a newline-terminated message, which must fit in the
+// reader's buffer
+func readMessage(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		return "", fmt.Errorf("%w: message exceeds %d bytes", errMalformedResponse, reader.Size())
+	}
 	if err != nil {
-		return "", time.Time{}, err
+		return "", err
 	}
-	response := strings.TrimSpace(string(buffer[:n]))
 
-	return s.parseResponse(response)
+	return strings.TrimSpace(string(line)), nil
 }
 
-// parseResponse extracts the nonce and timestamp from the client's response
-func (s *WordOfWisdomServer) parseResponse(response string) (string, time.Time, error) {
-	parts := strings.Split(response, ";")
-	if len(parts) != 2 {
-		return "", time.Time{}, errors.New("invalid response format")
+// parseResponse extracts the nonce, timestamp and optional fields from the
+// client's response, formatted as Nonce:<nonce>;Timestamp:<timestamp>[;Key:Value...]
+func (s *WordOfWisdomServer) parseResponse(response string) (clientResponse, error) {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(response, ";") {
+		key, value, ok := strings.Cut(part, ":")
+		if !ok {
+			return clientResponse{}, fmt.Errorf("%w: invalid response format", errMalformedResponse)
+		}
+		fields[key] = value
+	}
+
+	nonce, hasNonce := fields["Nonce"]
+	timestampStr, hasTimestamp := fields["Timestamp"]
+	if !hasNonce || !hasTimestamp {
+		return clientResponse{}, fmt.Errorf("%w: invalid response format", errMalformedResponse)
 	}
 
-	nonce := strings.TrimPrefix(parts[0], "Nonce:")
-	timestampStr := strings.TrimPrefix(parts[1], "Timestamp:")
 	timestamp, err := time.Parse(time.RFC3339Nano, timestampStr)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("invalid timestamp format: %w", err)
+		return clientResponse{}, fmt.Errorf("%w: invalid timestamp format: %w", errMalformedResponse, err)
+	}
+
+	parsed := clientResponse{
+		nonce:     nonce,
+		timestamp: timestamp,
+		challenge: fields["Challenge"],
+		next:      fields["Next"] == "1",
+		subscribe: fields["Subscribe"] == "1",
+		purpose:   fields["Purpose"],
+		software:  truncate(fields["Client"], maxSoftwareLength),
+	}
+	if attemptsStr, ok := fields["Attempts"]; ok {
+		if parsed.attempts, err = strconv.Atoi(attemptsStr); err != nil {
+			return clientResponse{}, fmt.Errorf("%w: invalid attempts value: %w", errMalformedResponse, err)
+		}
+	}
+
+	return parsed, nil
+}
+
+// truncate cuts s down to at most limit bytes without splitting a character
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
 	}
 
-	return nonce, timestamp, nil
+	return strings.ToValidUTF8(s[:limit], "")
 }
 
-// verifyPoW validates the client's PoW solution
-func (s *WordOfWisdomServer) verifyPoW(challenge, nonce string, clientTimestamp, serverTimestamp time.Time, difficulty int) bool {
-	// Check if the client's timestamp is within the allowed TimeWindow
-	if time.Since(clientTimestamp) > s.config.TimeWindow {
-		s.logger.Warn("Timestamp expired", zap.Time("client_timestamp", clientTimestamp), zap.Duration("time_window", s.config.TimeWindow))
+// rejectMalformedResponse answers an unparseable response according to the
+// configured policy
+func (s *WordOfWisdomServer) rejectMalformedResponse(conn net.Conn) {
+	switch s.config.MalformedResponsePolicy {
+	case config.MalformedResponseHint:
+		s.sendError(conn, protocol.CodeMalformed, "Malformed response, expected Nonce:<nonce>;Timestamp:<RFC3339Nano timestamp>.")
+	case config.MalformedResponseDrop:
+		// Say nothing so probing clients learn nothing about the protocol
+	default:
+		s.sendError(conn, protocol.CodeMalformed, "Invalid response.")
+	}
+}
 
-		return false
+// verifyPoW validates the client's PoW solution, returning why it is invalid
+func (s *WordOfWisdomServer) verifyPoW(ctx context.Context, challenge string, issued replay.Challenge, nonce string, clientTimestamp time.Time, logger *zap.Logger) error {
+	now := time.Now()
+	serverTimestamp, difficulty := issued.Timestamp, issued.Difficulty
+
+	// The solution is only valid for the challenge's time window after it was
+	// issued, the window being derived from the difficulty it was issued with
+	window := s.timeWindow(difficulty)
+	if now.Sub(serverTimestamp) > window {
+		logger.Warn("Timestamp expired", zap.Time("server_timestamp", serverTimestamp), zap.Duration("time_window", window))
+
+		return fmt.Errorf("challenge issued at %s is past the %s time window, server time %s",
+			pow.CanonicalTimestamp(serverTimestamp), window, pow.CanonicalTimestamp(now))
+	}
+
+	// The client's clock may be off from ours by at most maxClockSkew either way
+	if skew := now.Sub(clientTimestamp).Abs(); skew > s.maxClockSkew() {
+		logger.Warn("Client clock skew too large", zap.Time("client_timestamp", clientTimestamp), zap.Duration("skew", skew))
+
+		return fmt.Errorf("client timestamp %s is %s off, more than %s from server time %s",
+			pow.CanonicalTimestamp(clientTimestamp), skew, s.maxClockSkew(), pow.CanonicalTimestamp(now))
+	}
+
+	// The required difficulty is clamped to the configured range so that a
+	// corrupt record can't lower or raise it
+	required := min(max(difficulty, s.difficultyFloor()), highestMaxDifficulty(s.config))
+
+	return s.checkHash(ctx, challenge, issued, nonce, s.config.HashTimestampFormat, required, logger)
+}
+
+// checkHash checks that the solution was hashed the way this server hashes
+// them and that the hash has at least required leading zeros, whatever the
+// time; the timestamp is hashed in format
+func (s *WordOfWisdomServer) checkHash(ctx context.Context, challenge string, issued replay.Challenge, nonce string, format pow.TimestampFormat, required int, logger *zap.Logger) error {
+	// Challenges of other namespaces, e.g. from a replay store shared between
+	// tenants, are not ours to accept
+	if !strings.HasPrefix(challenge, s.namespacePrefix()) {
+		return fmt.Errorf("challenge was not issued in namespace %q", s.config.ChallengeNamespace)
+	}
+
+	// The nonce is hashed as sent, but must be in the announced encoding
+	if !s.config.NonceEncoding.Check(nonce) {
+		return fmt.Errorf("nonce %q is not %s encoded", nonce, s.nonceEncoding())
+	}
+
+	// Nobody waits for the verdict anymore
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
 	// Use the original serverTimestamp for PoW verification
-	data := fmt.Sprintf("%s%s%s", challenge, nonce, serverTimestamp.Format(time.RFC3339Nano))
-	s.logger.Debug("Verifying PoW", zap.String("data", data))
+	sum := pow.SumWith(s.layout, challenge, nonce, issued.Timestamp, format, issued.Purpose)
+	hashHex := hex.EncodeToString(sum[:])
+	logger.Debug("Computed hash", zap.String("hashHex", hashHex))
+
+	if !strings.HasPrefix(hashHex, strings.Repeat("0", required)) {
+		return fmt.Errorf("hash %s has fewer than %d leading zeros", hashHex, required)
+	}
 
-	// Compute the hash
-	hash := sha256.Sum256([]byte(data))
-	hashHex := hex.EncodeToString(hash[:])
+	return nil
+}
+
+// rejectionCode reports a rejected solution as expired when its challenge is
+// past the time window, as a fresh challenge solved in time would succeed,
+// and as a bad proof of work otherwise
+func (s *WordOfWisdomServer) rejectionCode(issued replay.Challenge) string {
+	if time.Since(issued.Timestamp) > s.timeWindow(issued.Difficulty) {
+		return protocol.CodeExpired
+	}
+
+	return protocol.CodeBadPoW
+}
 
-	s.logger.Debug("Computed hash", zap.String("hashHex", hashHex))
+// rejectionMessage describes a rejected solution to the client, giving the
+// reason only when VerboseErrors is set so as not to help attackers
+func (s *WordOfWisdomServer) rejectionMessage(reason error) string {
+	if !s.config.VerboseErrors || reason == nil {
+		return "Invalid proof of work."
+	}
+
+	return fmt.Sprintf("Invalid proof of work: %s.", reason)
+}
 
-	// Check if the hash meets the required difficulty
-	requiredPrefix := strings.Repeat("0", difficulty)
+// nonceEncoding returns the encoding nonces must be in
+func (s *WordOfWisdomServer) nonceEncoding() pow.NonceEncoding {
+	if s.config.NonceEncoding == "" {
+		return pow.NonceDecimal
+	}
+
+	return s.config.NonceEncoding
+}
 
-	return strings.HasPrefix(hashHex, requiredPrefix)
+// timeWindow returns how long a challenge of the given difficulty may be
+// solved for after it was issued
+func (s *WordOfWisdomServer) timeWindow(difficulty int) time.Duration {
+	return windowFor(s.config, difficulty)
 }
 
-// getRandomQuote selects a random quote from the list
+// windowFor is the time window of a challenge of the given difficulty: the
+// base TimeWindow plus TimeWindowPerDifficulty for every difficulty level
+func windowFor(cfg config.ServerConfig, difficulty int) time.Duration {
+	return cfg.TimeWindow + time.Duration(max(difficulty, 0))*cfg.TimeWindowPerDifficulty
+}
+
+// replayTTL is how long issued challenges are remembered, covering the time
+// window of the hardest possible challenge so that no solution outlives its
+// replay protection
+func replayTTL(cfg config.ServerConfig) time.Duration {
+	return windowFor(cfg, pow.MaxDifficulty)
+}
+
+// maxClockSkew returns the tolerated client clock skew
+func (s *WordOfWisdomServer) maxClockSkew() time.Duration {
+	if s.config.MaxClockSkew > 0 {
+		return s.config.MaxClockSkew
+	}
+
+	return s.config.TimeWindow
+}
+
+// getRandomQuote selects a random quote from the list, in proportion to the
+// quote weights when there are any. With QuoteBucket set the choice is seeded
+// by the current bucket, so everyone gets the same quote within a bucket
 func (s *WordOfWisdomServer) getRandomQuote() string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	seed := time.Now().UnixNano()
+	if s.config.QuoteBucket > 0 {
+		seed /= int64(s.config.QuoteBucket)
+	}
+	r := rand.New(rand.NewSource(seed))
+	set := s.quotes.Load()
+
+	if len(set.weights) == 0 {
+		return set.quotes[r.Intn(len(set.quotes))]
+	}
 
-	return s.quotes[r.Intn(len(s.quotes))]
+	target := r.Float64() * set.weights[len(set.weights)-1]
+	i := sort.Search(len(set.weights), func(i int) bool {
+		return set.weights[i] > target
+	})
+
+	return set.quotes[min(i, len(set.quotes)-1)]
 }
 
-// sendQuote transmits a quote to the client
-func (s *WordOfWisdomServer) sendQuote(conn net.Conn, quote string) error {
+// cumulativeWeights returns the running totals of weights
+func cumulativeWeights(weights []float64) []float64 {
+	if weights == nil {
+		return nil
+	}
+
+	totals := make([]float64, len(weights))
+	total := 0.0
+	for i, weight := range weights {
+		total += weight
+		totals[i] = total
+	}
+
+	return totals
+}
+
+// sendQuote transmits a quote to the client, in chunks when QuoteChunkBytes
+// is set. writeDeadline is the write deadline set on conn by the caller, zero
+// for none
+func (s *WordOfWisdomServer) sendQuote(conn net.Conn, quote string, writeDeadline time.Time) error {
 	message := fmt.Sprintf("Quote:%s\n", quote)
+	if s.config.QuoteChunkBytes > 0 {
+		return s.writeChunked(conn, []byte(message), s.config.QuoteChunkBytes, writeDeadline)
+	}
+
 	_, err := conn.Write([]byte(message))
 
 	return err
 }
 
-// sendError notifies the client of an error
-func (s *WordOfWisdomServer) sendError(conn net.Conn, errorMessage string) {
-	message := fmt.Sprintf("Error:%s\n", errorMessage)
+// writeChunked writes message in chunks of at most size bytes, giving each
+// ConnectionTimeout to go out, so that a client reading a large message
+// slowly can't hold the worker for long. No chunk may go out past
+// writeDeadline, the caller's deadline which is restored afterwards
+func (s *WordOfWisdomServer) writeChunked(conn net.Conn, message []byte, size int, writeDeadline time.Time) error {
+	timeout := s.limits().ConnectionTimeout
+	for len(message) > 0 {
+		chunk := message[:min(size, len(message))]
+		deadline := time.Now().Add(timeout)
+		if !writeDeadline.IsZero() && writeDeadline.Before(deadline) {
+			deadline = writeDeadline
+		}
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			return err
+		}
+		message = message[len(chunk):]
+	}
+
+	return conn.SetWriteDeadline(writeDeadline)
+}
+
+// sendError notifies the client of an error with one of the protocol codes
+func (s *WordOfWisdomServer) sendError(conn net.Conn, code, errorMessage string) {
+	message := fmt.Sprintf("Error:%s:%s\n", code, errorMessage)
 
 	_, err := conn.Write([]byte(message))
 	if err != nil {
@@ -284,7 +1213,75 @@ func (s *WordOfWisdomServer) sendError(conn net.Conn, errorMessage string) {
 	}
 }
 
+// newFileLogger creates a production logger writing to the given file
+func newFileLogger(file *logfile.File) *zap.Logger {
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	core := zapcore.NewCore(encoder, zapcore.AddSync(file), zap.InfoLevel)
+
+	return zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.ErrorLevel))
+}
+
+// reopenable is a file sink that can be reopened after external rotation
+type reopenable interface {
+	Reopen() error
+	Path() string
+}
+
+// reopenOnSignal reopens the given files every time SIGUSR1 is received
+// until ctx is done. The signal is handled by the time it returns
+func reopenOnSignal(ctx context.Context, logger *zap.Logger, files ...reopenable) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+			}
+
+			for _, f := range files {
+				if err := f.Reopen(); err != nil {
+					logger.Error("Failed to reopen file", zap.String("path", f.Path()), zap.Error(err))
+
+					continue
+				}
+				logger.Info("Reopened file", zap.String("path", f.Path()))
+			}
+		}
+	}()
+}
+
+// reloadQuotesOnSignal reloads the quotes every time SIGHUP is received
+// until ctx is done, keeping the current ones when the reload fails. The
+// signal is handled by the time it returns
+func reloadQuotesOnSignal(ctx context.Context, s *WordOfWisdomServer) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signals:
+				if err := s.LoadQuotes(); err != nil {
+					s.logger.Error("Failed to reload quotes", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
 func main() {
+	verifyPath := flag.String("verify-solutions", "", "replay the solutions recorded in this file against the configured server and exit")
+	flag.Parse()
+
 	logger, err := zap.NewProduction()
 	if err != nil {
 		log.Fatalf("Failed to initialize zap logger: %v", err)
@@ -298,7 +1295,85 @@ func main() {
 		logger.Fatal("Failed to load config", zap.Error(err))
 	}
 
+	// Every file written to is reopened on SIGUSR1, once they are all open
+	var sinks []reopenable
+
+	if cfg.Server.LogFile != "" {
+		logFile, openErr := logfile.Open(cfg.Server.LogFile)
+		if openErr != nil {
+			logger.Fatal("Failed to open log file", zap.Error(openErr))
+		}
+		defer func() {
+			_ = logFile.Close()
+		}()
+
+		logger = newFileLogger(logFile)
+		sinks = append(sinks, logFile)
+	}
+
 	server := NewServer(cfg.Server, logger)
+	if *verifyPath != "" {
+		total, failed, verifyErr := server.VerifyRecording(*verifyPath)
+		if verifyErr != nil {
+			logger.Fatal("Failed to read recording", zap.Error(verifyErr))
+		}
+		logger.Info("Verified recorded solutions", zap.Int("total", total), zap.Int("failed", failed))
+		if failed > 0 {
+			_ = logger.Sync()
+			os.Exit(1)
+		}
+
+		return
+	}
+	if cfg.Server.SharedLoadURL != "" {
+		instance, _ := os.Hostname()
+		server.UseLoadSource(newHTTPLoadSource(cfg.Server.SharedLoadURL, instance, cfg.Server.SharedLoadInterval))
+	}
+	if cfg.Server.ReplayStorePath != "" {
+		store, storeErr := replay.OpenFileStore(cfg.Server.ReplayStorePath, replayTTL(cfg.Server), maxOutstandingChallenges)
+		if storeErr != nil {
+			logger.Fatal("Failed to open replay store", zap.Error(storeErr))
+		}
+		defer func() {
+			_ = store.Close()
+		}()
+
+		server.UseReplayStore(store)
+		sinks = append(sinks, store)
+	}
+	if cfg.Server.RecordSolutionsPath != "" {
+		recorder, recordErr := recording.Open(cfg.Server.RecordSolutionsPath)
+		if recordErr != nil {
+			logger.Fatal("Failed to open solution recording", zap.Error(recordErr))
+		}
+		defer func() {
+			_ = recorder.Close()
+		}()
+
+		server.UseRecorder(recorder)
+		sinks = append(sinks, recorder)
+	}
+	if len(sinks) > 0 {
+		reopenOnSignal(context.Background(), logger, sinks...)
+	}
+	if cfg.Server.QuotesSource != config.QuotesSourceBuiltin {
+		if err := server.LoadQuotes(); err != nil {
+			logger.Fatal("Failed to load quotes", zap.Error(err))
+		}
+	}
+	if cfg.Server.QuotesSource == config.QuotesSourceFile {
+		reloadQuotesOnSignal(context.Background(), server)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// A second signal kills the server during the grace period
+		stop()
+		server.Shutdown()
+	}()
+
 	if err := server.Start(); err != nil {
 		logger.Fatal("Server error", zap.Error(err))
 	}
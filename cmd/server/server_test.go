@@ -0,0 +1,811 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/loopback"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/protocol"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNewServerAppliesDefaults(t *testing.T) {
+	cfg := config.ServerConfig{DifficultyMetric: config.DifficultyMetricRate}
+	s := NewServer(cfg, zap.NewNop())
+
+	if s.config.ReadBufferBytes != config.DefaultReadBufferBytes {
+		t.Errorf("read buffer of %d bytes, want %d", s.config.ReadBufferBytes, config.DefaultReadBufferBytes)
+	}
+	if s.config.SharedLoadInterval != config.DefaultSharedLoadInterval {
+		t.Errorf("shared load interval %s, want %s", s.config.SharedLoadInterval, config.DefaultSharedLoadInterval)
+	}
+	if s.config.RateWindow != config.DefaultRateWindow {
+		t.Errorf("rate window %s, want %s", s.config.RateWindow, config.DefaultRateWindow)
+	}
+	if *s.config.ShutdownGracePeriod != config.DefaultShutdownGracePeriod {
+		t.Errorf("shutdown grace period %s, want %s", *s.config.ShutdownGracePeriod, config.DefaultShutdownGracePeriod)
+	}
+
+	// The rate metric divides by the rate window
+	s.adjustDifficulty()
+	if rate := s.requestRate.perSecond(time.Now()); rate <= 0 {
+		t.Errorf("request rate %g after a request, want it positive", rate)
+	}
+
+	// Values that are set are kept
+	cfg.RateWindow = time.Minute
+	if s := NewServer(cfg, zap.NewNop()); s.config.RateWindow != time.Minute {
+		t.Errorf("rate window %s, want the configured %s", s.config.RateWindow, time.Minute)
+	}
+}
+
+func TestResubmittedChallengeReportedAsReused(t *testing.T) {
+	// Over TCP, a challenge spent while the client worked on it
+	answer := tamperedExchange(t, testServerConfig(), zap.NewNop(), honeypotTampers["replayed"])
+	if !strings.HasPrefix(answer, "Error:"+protocol.CodeReused+":") {
+		t.Errorf("spent challenge over TCP: answered %q, want %s", answer, protocol.CodeReused)
+	}
+
+	// Over HTTP, the same solution submitted twice
+	s := NewServer(testServerConfig(), zap.NewNop())
+	gateway := httptest.NewServer(newHTTPGateway(s).handler())
+	defer gateway.Close()
+
+	issued := fetchChallenge(t, gateway.URL, "")
+	nonce := solveIssued(t, s, issued.Challenge, replay.Challenge{Timestamp: issued.Timestamp, Difficulty: issued.Difficulty})
+	request := httpQuoteRequest{Challenge: issued.Challenge, Nonce: nonce, Timestamp: time.Now().UTC()}
+
+	for i, want := range []string{"", protocol.CodeReused} {
+		if _, body := submitQuote(t, gateway.URL, request); body.Code != want {
+			t.Errorf("submission %d: code %q, want %q", i+1, body.Code, want)
+		}
+	}
+}
+
+func TestClockSkewSeparateFromTimeWindow(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.TimeWindow = time.Hour
+	cfg.MaxClockSkew = time.Second
+	s := NewServer(cfg, zap.NewNop())
+
+	now := time.Now()
+	tests := []struct {
+		name            string
+		issuedAgo       time.Duration
+		clientTimestamp time.Time
+		want            string
+	}{
+		{"in sync", 0, now, ""},
+		// Solving for long is fine as long as the clocks agree
+		{"slow solve", 30 * time.Minute, now, ""},
+		{"client ahead", 0, now.Add(5 * time.Second), "off, more than 1s"},
+		{"client behind", 0, now.Add(-5 * time.Second), "off, more than 1s"},
+		{"expired", 2 * time.Hour, now, "past the 1h0m0s time window"},
+	}
+
+	for _, tt := range tests {
+		issued := replay.Challenge{Timestamp: now.Add(-tt.issuedAgo), Difficulty: 1}
+		nonce := solveIssued(t, s, "skew", issued)
+		err := s.verifyPoW(context.Background(), "skew", issued, nonce, tt.clientTimestamp, zap.NewNop())
+		if tt.want == "" && err != nil {
+			t.Errorf("%s: %v, want it accepted", tt.name, err)
+		}
+		if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("%s: %v, want an error containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMalformedResponsePolicies(t *testing.T) {
+	tests := []struct {
+		policy, answer string
+	}{
+		{config.MalformedResponseGeneric, "Error:MALFORMED:Invalid response."},
+		{config.MalformedResponseHint, "Error:MALFORMED:Malformed response, expected Nonce:<nonce>;Timestamp:<RFC3339Nano timestamp>."},
+		// Dropped connections are closed without a word
+		{config.MalformedResponseDrop, ""},
+	}
+
+	for _, tt := range tests {
+		cfg := testServerConfig()
+		cfg.MalformedResponsePolicy = tt.policy
+		_, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		if _, err := reader.ReadString('\n'); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.Write([]byte("garbage\n")); err != nil {
+			t.Fatal(err)
+		}
+		answer, err := reader.ReadString('\n')
+		_ = conn.Close()
+		if tt.answer == "" && !errors.Is(err, io.EOF) {
+			t.Errorf("policy %s: answered %q, %v; want the connection closed", tt.policy, answer, err)
+		}
+		if tt.answer != "" && strings.TrimSpace(answer) != tt.answer {
+			t.Errorf("policy %s: answered %q, %v; want %q", tt.policy, answer, err, tt.answer)
+		}
+	}
+}
+
+func TestReadBufferBoundsResponses(t *testing.T) {
+	// A response padded past the default buffer, e.g. by a long client
+	// software string
+	padding := ";Client:" + strings.Repeat("x", 2*config.DefaultReadBufferBytes)
+
+	for _, size := range []int{config.DefaultReadBufferBytes, 4 * config.DefaultReadBufferBytes} {
+		cfg := testServerConfig()
+		cfg.ReadBufferBytes = size
+		s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, _, err := solutionFor(t, s, line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The server may answer before taking in the whole line
+		go func() {
+			_, _ = conn.Write([]byte(response + padding + "\n"))
+		}()
+		answer, err := reader.ReadString('\n')
+		_ = conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := "Quote:"
+		if size == config.DefaultReadBufferBytes {
+			want = "Error:MALFORMED:"
+		}
+		if !strings.HasPrefix(answer, want) {
+			t.Errorf("%d byte buffer: answered %q, want %s", size, answer, want)
+		}
+	}
+}
+
+// failingRandom fails its first read, as an exhausted entropy source would,
+// and reads from crypto/rand after that
+type failingRandom struct {
+	failed atomic.Bool
+}
+
+func (r *failingRandom) Read(b []byte) (int, error) {
+	if r.failed.CompareAndSwap(false, true) {
+		return 0, errors.New("entropy source unavailable")
+	}
+
+	return cryptorand.Read(b)
+}
+
+func TestFailingRandomSourceAnswersInternalError(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	cfg := testServerConfig()
+	cfg.MaxConnections = 1
+	s := NewServer(cfg, zap.New(core))
+	s.random = &failingRandom{}
+	listener := loopback.NewListener()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Serve(listener)
+	}()
+	defer func() {
+		_ = listener.Close()
+		<-done
+	}()
+	<-s.Ready()
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	answer, err := reader.ReadString('\n')
+	if err != nil || strings.TrimSpace(answer) != "Error:INTERNAL:Internal server error." {
+		t.Fatalf("answered %q, %v; want an internal error", answer, err)
+	}
+	if _, err := reader.ReadString('\n'); !errors.Is(err, io.EOF) {
+		t.Errorf("connection left open after the internal error: %v", err)
+	}
+	_ = conn.Close()
+	if logs.FilterMessage("Failed to generate challenge").FilterLevelExact(zapcore.ErrorLevel).Len() != 1 {
+		t.Errorf("failure not logged at error level: %v", logs.All())
+	}
+
+	// The only worker survived and serves the next client
+	conn, err = listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if answer, err := requestQuote(t, s, conn); err != nil || !strings.HasPrefix(answer, "Quote:") {
+		t.Errorf("next client answered %q, %v; want a quote", answer, err)
+	}
+}
+
+func TestRequireChallengeEcho(t *testing.T) {
+	tests := []struct {
+		name    string
+		require bool
+		// echo turns the challenge into the echoed one
+		echo   func(challenge string) string
+		answer string
+	}{
+		{"echoed", true, func(c string) string { return c }, "Quote:"},
+		{"other challenge", true, func(string) string { return "forged" }, "Error:MISMATCH:"},
+		{"no echo", true, func(string) string { return "" }, "Error:MISMATCH:"},
+		{"not required", false, func(string) string { return "forged" }, "Quote:"},
+	}
+
+	for _, tt := range tests {
+		cfg := testServerConfig()
+		cfg.RequireChallengeEcho = tt.require
+		s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, _, err := solutionFor(t, s, line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The solution is valid, only the echo differs
+		response, challenge, _ := strings.Cut(response, ";Challenge:")
+		if echoed := tt.echo(challenge); echoed != "" {
+			response += ";Challenge:" + echoed
+		}
+		if _, err := conn.Write([]byte(response + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		answer, err := reader.ReadString('\n')
+		_ = conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(answer, tt.answer) {
+			t.Errorf("%s: answered %q, want %s", tt.name, answer, tt.answer)
+		}
+	}
+}
+
+func TestChallengeSendJitterWithinBound(t *testing.T) {
+	const jitter = 100 * time.Millisecond
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 1
+	cfg.ChallengeSendJitter = jitter
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	var longest time.Duration
+	for range 5 {
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		delay := time.Since(start)
+		if delay > jitter+250*time.Millisecond {
+			t.Errorf("challenge sent after %v, the jitter is %v", delay, jitter)
+		}
+		longest = max(longest, delay)
+
+		// The held back challenge is solved as usual
+		response, ok, err := solutionFor(t, s, line)
+		if err != nil || !ok {
+			t.Fatalf("no challenge in %q: %v", line, err)
+		}
+		if _, err := conn.Write([]byte(response + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Quote:") {
+			t.Fatalf("answered %q, %v; want a quote", answer, err)
+		}
+		_ = conn.Close()
+	}
+	if longest < 10*time.Millisecond {
+		t.Errorf("challenges sent within %v, not delayed by the jitter", longest)
+	}
+}
+
+func TestKeepAlivePingsOutlastIdleTimeout(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 1
+	cfg.ConnectionTimeout = 200 * time.Millisecond
+	cfg.KeepAlive = true
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A long solve, lasting several idle timeouts, kept alive by pings
+	for range 10 {
+		time.Sleep(cfg.ConnectionTimeout / 4)
+		if _, err := conn.Write([]byte(pingMessage + "\n")); err != nil {
+			t.Fatalf("connection dropped while pinging: %v", err)
+		}
+		if pong, err := reader.ReadString('\n'); err != nil || pong != pongMessage+"\n" {
+			t.Fatalf("answered the ping with %q, %v; want %s", pong, err, pongMessage)
+		}
+	}
+
+	response, ok, err := solutionFor(t, s, line)
+	if err != nil || !ok {
+		t.Fatalf("no challenge in %q: %v", line, err)
+	}
+	if _, err := conn.Write([]byte(response + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Quote:") {
+		t.Fatalf("answered %q, %v; want a quote", answer, err)
+	}
+}
+
+func TestConcurrentConnectionsPerIPCapped(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MaxConcurrentPerIP = 2
+	_, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	// firstLine dials from the single loopback address and reads what the
+	// server sends first
+	firstLine := func() (net.Conn, string) {
+		t.Helper()
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return conn, line
+	}
+
+	var held []net.Conn
+	for range cfg.MaxConcurrentPerIP {
+		conn, line := firstLine()
+		if !strings.HasPrefix(line, "Challenge:") {
+			t.Fatalf("connection within the cap answered %q", line)
+		}
+		held = append(held, conn)
+	}
+
+	conn, line := firstLine()
+	_ = conn.Close()
+	if !strings.HasPrefix(line, "Error:"+protocol.CodeLimit+":") {
+		t.Fatalf("connection over the cap answered %q, want %s", line, protocol.CodeLimit)
+	}
+
+	// Ending a connection frees its slot
+	_ = held[0].Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, line := firstLine()
+		_ = conn.Close()
+		if strings.HasPrefix(line, "Challenge:") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("slot never freed, answered %q", line)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = held[1].Close()
+}
+
+func TestChainedQuotesOnOneConnection(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 1
+	cfg.MaxChainedChallenges = 1
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both solutions ask for more, only one chained challenge is allowed
+	reader := bufio.NewReader(conn)
+	for i := range 2 {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("quote %d: no challenge: %v", i+1, err)
+		}
+		response, ok, err := solutionFor(t, s, line)
+		if err != nil || !ok {
+			t.Fatalf("quote %d: no challenge in %q: %v", i+1, line, err)
+		}
+		if _, err := conn.Write([]byte(response + ";Next:1\n")); err != nil {
+			t.Fatal(err)
+		}
+		if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Quote:") {
+			t.Fatalf("quote %d: answered %q, %v", i+1, answer, err)
+		}
+	}
+
+	if line, err := reader.ReadString('\n'); !errors.Is(err, io.EOF) {
+		t.Errorf("read %q, %v past max_chained_challenges; want the connection closed", line, err)
+	}
+}
+
+func TestSolutionForOtherPurposeRejected(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 1
+	cfg.Purpose = "download"
+
+	// The nonce is hashed for signup, then either echoed as is or passed off
+	// as being for the issued purpose
+	for echoed, code := range map[string]string{"signup": protocol.CodeMismatch, "download": protocol.CodeBadPoW} {
+		s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := make(map[string]string)
+		for _, part := range strings.Split(strings.TrimSpace(line), ";") {
+			key, value, _ := strings.Cut(part, ":")
+			fields[key] = value
+		}
+		if fields["Purpose"] != "download" {
+			t.Fatalf("challenge %q doesn't carry the purpose", line)
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, fields["Timestamp"])
+		if err != nil {
+			t.Fatal(err)
+		}
+		difficulty, err := strconv.Atoi(fields["Difficulty"])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A nonce that happens to solve both purposes would prove nothing
+		solves := func(nonce, purpose string) bool {
+			sum := pow.SumWith(s.layout, fields["Challenge"], nonce, timestamp, s.config.HashTimestampFormat, purpose)
+
+			return strings.HasPrefix(hex.EncodeToString(sum[:]), strings.Repeat("0", difficulty))
+		}
+		var nonce string
+		for n := 0; nonce == ""; n++ {
+			if candidate := strconv.Itoa(n); solves(candidate, "signup") && !solves(candidate, "download") {
+				nonce = candidate
+			}
+		}
+		response := fmt.Sprintf("Nonce:%s;Timestamp:%s;Challenge:%s;Purpose:%s",
+			nonce, time.Now().UTC().Format(time.RFC3339Nano), fields["Challenge"], echoed)
+		if _, err := conn.Write([]byte(response + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Error:"+code+":") {
+			t.Errorf("signup solution echoing %s answered %q, %v; want %s", echoed, answer, err, code)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestBannerSentBeforeChallenge(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.Banner = "WOW-PoW/1"
+	_, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	for _, prefix := range []string{cfg.Banner + "\n", "Challenge:"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, prefix) {
+			t.Fatalf("read %q, want %q first", line, prefix)
+		}
+	}
+}
+
+func TestVerboseErrorsGiveReasonAndServerTime(t *testing.T) {
+	for _, verbose := range []bool{false, true} {
+		cfg := testServerConfig()
+		cfg.MaxDifficulty = 1
+		cfg.MaxClockSkew = time.Second
+		cfg.VerboseErrors = verbose
+		s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, ok, err := solutionFor(t, s, line)
+		if err != nil || !ok {
+			t.Fatalf("no challenge in %q: %v", line, err)
+		}
+
+		// A valid solution from a client whose clock is an hour ahead
+		ahead := time.Now().Add(time.Hour).UTC().Format(time.RFC3339Nano)
+		fields := strings.Split(response, ";")
+		for i, field := range fields {
+			if strings.HasPrefix(field, "Timestamp:") {
+				fields[i] = "Timestamp:" + ahead
+			}
+		}
+		if _, err := conn.Write([]byte(strings.Join(fields, ";") + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		answer, err := reader.ReadString('\n')
+		_ = conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer = strings.TrimSpace(answer)
+
+		if !verbose {
+			if answer != "Error:BADPOW:Invalid proof of work." {
+				t.Errorf("answered %q without verbose_errors, want the opaque error", answer)
+			}
+
+			continue
+		}
+		for _, want := range []string{"Error:BADPOW:", "client timestamp " + ahead} {
+			if !strings.Contains(answer, want) {
+				t.Errorf("verbose answer %q lacks %q", answer, want)
+			}
+		}
+		_, serverTime, _ := strings.Cut(strings.TrimSuffix(answer, "."), "server time ")
+		if at, err := time.Parse(time.RFC3339Nano, serverTime); err != nil || time.Since(at).Abs() > time.Minute {
+			t.Errorf("verbose answer %q doesn't give the server time", answer)
+		}
+	}
+}
+
+func TestEpochNanosHashedTimestamp(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MinDifficulty, cfg.MaxDifficulty = 2, 2
+	cfg.HashTimestampFormat = pow.TimestampEpochNanos
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	// Solved and verified with the epoch representation
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, err := requestQuote(t, s, conn)
+	_ = conn.Close()
+	if err != nil || !strings.HasPrefix(quote, "Quote:") {
+		t.Fatalf("answered %q, %v; want a quote", quote, err)
+	}
+
+	// A nonce found hashing the RFC 3339 form doesn't verify
+	issued := replay.Challenge{Timestamp: time.Now().UTC(), Difficulty: 2}
+	solves := func(nonce string, format pow.TimestampFormat) bool {
+		sum := pow.SumWith(s.layout, "epoch", nonce, issued.Timestamp, format, "")
+
+		return pow.HasLeadingZeros(sum, issued.Difficulty)
+	}
+	var nonce string
+	for n := 0; nonce == ""; n++ {
+		if candidate := strconv.Itoa(n); solves(candidate, pow.TimestampRFC3339Nano) && !solves(candidate, pow.TimestampEpochNanos) {
+			nonce = candidate
+		}
+	}
+	if err := s.verifyPoW(context.Background(), "epoch", issued, nonce, time.Now(), zap.NewNop()); err == nil {
+		t.Error("solution hashing the RFC 3339 timestamp accepted with epoch_nanos")
+	}
+}
+
+func TestNonceEncodingsRoundTrip(t *testing.T) {
+	for _, encoding := range []pow.NonceEncoding{pow.NonceDecimal, pow.NonceHex, pow.NonceBase64} {
+		cfg := testServerConfig()
+		cfg.MinDifficulty, cfg.MaxDifficulty = 2, 2
+		cfg.NonceEncoding = encoding
+		s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := make(map[string]string)
+		for _, part := range strings.Split(strings.TrimSpace(line), ";") {
+			key, value, _ := strings.Cut(part, ":")
+			fields[key] = value
+		}
+		if announced := pow.NonceEncoding(cmp.Or(fields["NonceEncoding"], string(pow.NonceDecimal))); announced != encoding {
+			t.Fatalf("%s: challenge %q announces %s", encoding, line, announced)
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, fields["Timestamp"])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Solved the way a client using the encoding does
+		var nonce string
+		for n := uint64(0); nonce == ""; n++ {
+			candidate := encoding.Encode(n)
+			if pow.HasLeadingZeros(pow.SumWith(s.layout, fields["Challenge"], candidate, timestamp, s.config.HashTimestampFormat, ""), 2) {
+				nonce = candidate
+			}
+		}
+		response := fmt.Sprintf("Nonce:%s;Timestamp:%s;Challenge:%s", nonce, time.Now().UTC().Format(time.RFC3339Nano), fields["Challenge"])
+		if _, err := conn.Write([]byte(response + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Quote:") {
+			t.Errorf("%s: nonce %s answered %q, %v; want a quote", encoding, nonce, answer, err)
+		}
+		_ = conn.Close()
+	}
+}
+
+func TestListenReportsAddressInUse(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = taken.Close() }()
+
+	cfg := testServerConfig()
+	cfg.Host = "127.0.0.1"
+	cfg.Port = taken.Addr().(*net.TCPAddr).Port
+	cfg.ListenRetries = 2
+	cfg.ListenRetryDelay = 10 * time.Millisecond
+	s := NewServer(cfg, zap.NewNop())
+
+	err = s.Start()
+	want := fmt.Sprintf("port %d already in use, is another instance running?", cfg.Port)
+	if !errors.Is(err, syscall.EADDRINUSE) || !strings.Contains(err.Error(), want) {
+		t.Fatalf("got %v, want %q", err, want)
+	}
+
+	// The port is bound once the other instance lets go of it
+	cfg.ListenRetries = 50
+	s = NewServer(cfg, zap.NewNop())
+	time.AfterFunc(50*time.Millisecond, func() { _ = taken.Close() })
+	listener, err := s.listen(taken.Addr().String())
+	if err != nil {
+		t.Fatalf("port never bound after being released: %v", err)
+	}
+	_ = listener.Close()
+}
+
+func TestTimeWindowGrowsWithDifficulty(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.TimeWindow = time.Minute
+	cfg.TimeWindowPerDifficulty = time.Minute
+	s := NewServer(cfg, zap.NewNop())
+
+	// Solved 150 seconds after being issued: past the 2 minutes of an easy
+	// challenge, within the 4 minutes of a hard one
+	issuedAt := time.Now().Add(-150 * time.Second)
+	for difficulty, accepted := range map[int]bool{1: false, 3: true} {
+		issued := replay.Challenge{Timestamp: issuedAt, Difficulty: difficulty}
+		nonce := solveIssued(t, s, "window", issued)
+		err := s.verifyPoW(context.Background(), "window", issued, nonce, time.Now(), zap.NewNop())
+		if accepted && err != nil {
+			t.Errorf("difficulty %d: %v, want it within the window", difficulty, err)
+		} else if !accepted && (err == nil || !strings.Contains(err.Error(), "past the 2m0s time window")) {
+			t.Errorf("difficulty %d: %v, want it past the window", difficulty, err)
+		}
+	}
+
+	// Issued challenges are remembered for as long as any can be solved
+	if ttl, widest := replayTTL(s.config), s.timeWindow(pow.MaxDifficulty); ttl < widest {
+		t.Errorf("replay TTL %s shorter than the widest time window %s", ttl, widest)
+	}
+}
+
+func TestClientSoftwareLoggedTruncated(t *testing.T) {
+	long := "wow-client/1.0 " + strings.Repeat("é", maxSoftwareLength)
+	for software, want := range map[string]string{
+		"wow-client/1.2.3": "wow-client/1.2.3",
+		// Cut at the limit, without leaving half a character behind
+		long: long[:maxSoftwareLength-1],
+	} {
+		cfg := testServerConfig()
+		cfg.MaxDifficulty = 1
+		core, logs := observer.New(zapcore.InfoLevel)
+		s, listener := startLoopbackServer(t, cfg, zap.New(core))
+
+		conn, err := listener.Dial(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader := bufio.NewReader(conn)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, ok, err := solutionFor(t, s, line)
+		if err != nil || !ok {
+			t.Fatalf("no challenge in %q: %v", line, err)
+		}
+		if _, err := conn.Write([]byte(response + ";Client:" + software + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Quote:") {
+			t.Fatalf("answered %q, %v; want a quote", answer, err)
+		}
+		_ = conn.Close()
+
+		entries := logs.FilterMessage("Client software").All()
+		if len(entries) != 1 {
+			t.Fatalf("client software logged %d times, want once", len(entries))
+		}
+		if logged := entries[0].ContextMap()["software"]; logged != want {
+			t.Errorf("logged software %q, want %q", logged, want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Shutdown stops accepting connections and makes Serve return once the
+// connections in flight are done, giving them ShutdownGracePeriod to submit
+// the solutions to the challenges they were already issued
+func (s *WordOfWisdomServer) Shutdown() {
+	if s.draining.CompareAndSwap(false, true) {
+		close(s.shutdown)
+	}
+
+	s.mu.Lock()
+	listener := s.listener
+	s.mu.Unlock()
+
+	s.logger.Info("Shutting down", zap.Duration("grace_period", *s.config.ShutdownGracePeriod))
+	if listener != nil {
+		_ = listener.Close()
+	}
+}
+
+// drain waits for the workers to finish the connections in flight, closing
+// the ones still open once ShutdownGracePeriod is over
+func (s *WordOfWisdomServer) drain(wg *sync.WaitGroup) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(*s.config.ShutdownGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return
+	case <-timer.C:
+	}
+
+	open := s.conns.all()
+	s.logger.Warn("Grace period over, closing connections", zap.Int("connections", len(open)))
+	for _, conn := range open {
+		_ = conn.Close()
+	}
+	<-done
+}
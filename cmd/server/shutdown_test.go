@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+)
+
+func TestShutdownLetsIssuedChallengeBeSolved(t *testing.T) {
+	// The grace period is left to its default
+	s, listener := startLoopbackServer(t, testServerConfig(), zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[string]string)
+	for _, part := range strings.Split(strings.TrimSpace(line), ";") {
+		key, value, _ := strings.Cut(part, ":")
+		fields[key] = value
+	}
+
+	// Shutdown begins while the client is still solving
+	s.Shutdown()
+	time.Sleep(50 * time.Millisecond)
+
+	timestamp, err := time.Parse(time.RFC3339Nano, fields["Timestamp"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	difficulty, err := strconv.Atoi(fields["Difficulty"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued := replay.Challenge{Timestamp: timestamp, Difficulty: difficulty}
+	nonce := solveIssued(t, s, fields["Challenge"], issued)
+	response := fmt.Sprintf("Nonce:%s;Timestamp:%s;Attempts:1;Challenge:%s",
+		nonce, time.Now().UTC().Format(time.RFC3339Nano), fields["Challenge"])
+	if _, err := conn.Write([]byte(response + "\n")); err != nil {
+		t.Fatalf("connection closed during the grace period: %v", err)
+	}
+
+	answer, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatalf("connection closed during the grace period: %v", err)
+	}
+	if !strings.HasPrefix(answer, "Quote:") {
+		t.Fatalf("expected a quote, got %q", answer)
+	}
+}
+
+func TestShutdownWithoutGraceClosesRightAway(t *testing.T) {
+	cfg := testServerConfig()
+	noGrace := time.Duration(0)
+	cfg.ShutdownGracePeriod = &noGrace
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	// The client is still solving, but isn't given any time to
+	s.Shutdown()
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if answer, err := reader.ReadString('\n'); !errors.Is(err, io.EOF) {
+		t.Fatalf("read %q, %v; want the connection closed", answer, err)
+	}
+}
+
+func TestShutdownCutsChallengeJitterShort(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.ChallengeSendJitter = time.Hour
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Shutdown begins while the challenge is held back
+	deadline := time.Now().Add(time.Second)
+	for len(s.conns.all()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection never handled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Shutdown()
+
+	if err := conn.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatalf("no answer after shutdown: %v", err)
+	}
+	if !strings.HasPrefix(line, "Error:BUSY:") {
+		t.Fatalf("answered %q after shutdown, want BUSY", line)
+	}
+}
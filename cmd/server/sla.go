@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"go.uber.org/zap"
+)
+
+// calibrationDuration is how long the hash rate is measured for at startup
+const calibrationDuration = 200 * time.Millisecond
+
+// calibrateDifficultyCeiling measures the hash rate of this machine and caps
+// the advertised difficulty to the highest one it solves within
+// SLAMaxSolveTime on average
+func (s *WordOfWisdomServer) calibrateDifficultyCeiling() {
+	hashRate := pow.MeasureHashRate(calibrationDuration)
+	ceiling := difficultyWithin(hashRate, s.config.SLAMaxSolveTime)
+
+	s.mu.Lock()
+	s.difficultyCeiling = ceiling
+	s.difficulty = min(s.difficulty, ceiling)
+	s.mu.Unlock()
+
+	s.logger.Info("Derived difficulty ceiling from SLA",
+		zap.Duration("sla_max_solve_time", s.config.SLAMaxSolveTime),
+		zap.Float64("hash_rate", hashRate),
+		zap.Int("ceiling", ceiling))
+	if ceiling < s.limits().MinDifficulty {
+		s.logger.Warn("SLA difficulty ceiling is below min_difficulty, it takes precedence",
+			zap.Int("ceiling", ceiling))
+	}
+}
+
+// difficultyWithin returns the highest difficulty, at least 1, whose expected
+// solve time at hashRate stays within limit
+func difficultyWithin(hashRate float64, limit time.Duration) int {
+	difficulty := 1
+	for difficulty < pow.MaxDifficulty && pow.ExpectedAttempts(difficulty+1)/hashRate <= limit.Seconds() {
+		difficulty++
+	}
+
+	return difficulty
+}
+
+// capDifficulty caps the difficulty to the SLA ceiling, if any; s.mu must be held
+func (s *WordOfWisdomServer) capDifficulty(difficulty int) int {
+	if s.difficultyCeiling == 0 {
+		return difficulty
+	}
+
+	return min(difficulty, s.difficultyCeiling)
+}
+
+// difficultyFloor returns the lowest difficulty a solution is accepted at:
+// the lowest min_difficulty of any preset, or the SLA ceiling when lower
+func (s *WordOfWisdomServer) difficultyFloor() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.capDifficulty(lowestMinDifficulty(s.config))
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestDifficultyWithin(t *testing.T) {
+	// At 16^4 hashes per second difficulty 4 takes a second on average
+	for _, tc := range []struct {
+		limit time.Duration
+		want  int
+	}{
+		{time.Second, 4},
+		{16 * time.Second, 5},
+		{15 * time.Second, 4},
+		// Even an SLA nothing meets leaves difficulty 1
+		{time.Nanosecond, 1},
+	} {
+		if got := difficultyWithin(65536, tc.limit); got != tc.want {
+			t.Errorf("within %s: difficulty %d, want %d", tc.limit, got, tc.want)
+		}
+	}
+}
+
+func TestSLACeilingCapsAdvertisedDifficulty(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.SLAMaxSolveTime = time.Nanosecond
+	s := NewServer(cfg, zap.NewNop())
+	s.calibrateDifficultyCeiling()
+
+	// Under the highest load, the SLA still wins over max_difficulty
+	s.clientLoad = s.config.MaxDifficultyLoad + 1
+	for range 10 {
+		if difficulty := s.adjustDifficulty(); difficulty > 1 {
+			t.Fatalf("advertised difficulty %d above the SLA ceiling 1", difficulty)
+		}
+	}
+}
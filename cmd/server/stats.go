@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+)
+
+// recentQuotesKept is how many of the last served quotes the stats remember
+const recentQuotesKept = 10
+
+// ServerStats is a snapshot of the server's state and counters
+type ServerStats struct {
+	ActiveClients     int      `json:"active_clients"`
+	Difficulty        int      `json:"difficulty"`
+	Preset            string   `json:"preset,omitempty"`
+	ChallengesIssued  int64    `json:"challenges_issued"`
+	SolutionsAccepted int64    `json:"solutions_accepted"`
+	SolutionsRejected int64    `json:"solutions_rejected"`
+	RecentQuotes      []string `json:"recent_quotes"`
+}
+
+// SuccessRate returns the share of the checked solutions that were accepted
+func (s ServerStats) SuccessRate() float64 {
+	checked := s.SolutionsAccepted + s.SolutionsRejected
+	if checked == 0 {
+		return 0
+	}
+
+	return float64(s.SolutionsAccepted) / float64(checked)
+}
+
+// statsCounters counts the outcomes of challenges since the server started
+type statsCounters struct {
+	mu           sync.Mutex
+	issued       int64
+	accepted     int64
+	rejected     int64
+	recentQuotes []string
+}
+
+// challengeIssued counts an issued challenge
+func (c *statsCounters) challengeIssued() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.issued++
+}
+
+// solutionAccepted counts an accepted solution and the quote it was served
+func (c *statsCounters) solutionAccepted(quote string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.accepted++
+	c.recentQuotes = append(c.recentQuotes, quote)
+	if len(c.recentQuotes) > recentQuotesKept {
+		c.recentQuotes = c.recentQuotes[len(c.recentQuotes)-recentQuotesKept:]
+	}
+}
+
+// solutionRejected counts a rejected solution
+func (c *statsCounters) solutionRejected() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rejected++
+}
+
+// Stats returns a snapshot of the server's state and counters
+func (s *WordOfWisdomServer) Stats() ServerStats {
+	s.stats.mu.Lock()
+	stats := ServerStats{
+		ChallengesIssued:  s.stats.issued,
+		SolutionsAccepted: s.stats.accepted,
+		SolutionsRejected: s.stats.rejected,
+		RecentQuotes:      append([]string(nil), s.stats.recentQuotes...),
+	}
+	s.stats.mu.Unlock()
+
+	s.mu.Lock()
+	stats.ActiveClients = s.clientLoad
+	stats.Difficulty = s.difficulty
+	stats.Preset = s.presetName
+	s.mu.Unlock()
+
+	return stats
+}
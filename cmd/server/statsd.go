@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// pushStatsD sends the server stats to StatsDAddress every StatsDInterval
+// until ctx is done: counters as the increase since the last push and the
+// active clients and difficulty as gauges
+func (s *WordOfWisdomServer) pushStatsD(ctx context.Context) {
+	defer s.crashOnPanic("statsd push")
+
+	conn, err := net.Dial("udp", s.config.StatsDAddress)
+	if err != nil {
+		s.logger.Error("Failed to set up StatsD", zap.String("address", s.config.StatsDAddress), zap.Error(err))
+
+		return
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	ticker := time.NewTicker(s.config.StatsDInterval)
+	defer ticker.Stop()
+
+	var last ServerStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			stats := s.Stats()
+			if _, err := conn.Write([]byte(statsDPacket(s.config.StatsDPrefix, stats, last))); err != nil {
+				s.logger.Warn("Failed to push StatsD metrics", zap.Error(err))
+			}
+			last = stats
+		}
+	}
+}
+
+// statsDPacket formats the stats as StatsD lines, counting the counters from
+// the previous stats
+func statsDPacket(prefix string, stats, previous ServerStats) string {
+	lines := []string{
+		fmt.Sprintf("%s.challenges_issued:%d|c", prefix, stats.ChallengesIssued-previous.ChallengesIssued),
+		fmt.Sprintf("%s.solutions.accepted:%d|c", prefix, stats.SolutionsAccepted-previous.SolutionsAccepted),
+		fmt.Sprintf("%s.solutions.rejected:%d|c", prefix, stats.SolutionsRejected-previous.SolutionsRejected),
+		fmt.Sprintf("%s.active_clients:%d|g", prefix, stats.ActiveClients),
+		fmt.Sprintf("%s.difficulty:%d|g", prefix, stats.Difficulty),
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestStatsDPushesMetrics(t *testing.T) {
+	receiver, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = receiver.Close() }()
+
+	cfg := testServerConfig()
+	cfg.MinDifficulty, cfg.MaxDifficulty = 2, 2
+	cfg.StatsDAddress = receiver.LocalAddr().String()
+	cfg.StatsDInterval = 20 * time.Millisecond
+	cfg.StatsDPrefix = "wow"
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, err := requestQuote(t, s, conn)
+	_ = conn.Close()
+	if err != nil || !strings.HasPrefix(quote, "Quote:") {
+		t.Fatalf("answered %q, %v; want a quote", quote, err)
+	}
+
+	// Counters are pushed as increases, so they are summed over the packets
+	// until the exchange shows up
+	counters := make(map[string]int)
+	gauges := make(map[string]string)
+	if err := receiver.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 1024)
+	for counters["wow.solutions.accepted"] == 0 {
+		n, _, err := receiver.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("no accepted solution pushed: %v", err)
+		}
+		for _, line := range strings.Split(string(buffer[:n]), "\n") {
+			name, rest, _ := strings.Cut(line, ":")
+			value, kind, _ := strings.Cut(rest, "|")
+			switch kind {
+			case "c":
+				count, err := strconv.Atoi(value)
+				if err != nil {
+					t.Fatalf("malformed counter %q", line)
+				}
+				counters[name] += count
+			case "g":
+				gauges[name] = value
+			default:
+				t.Fatalf("malformed line %q", line)
+			}
+		}
+	}
+
+	for name, want := range map[string]int{"wow.challenges_issued": 1, "wow.solutions.accepted": 1, "wow.solutions.rejected": 0} {
+		if counters[name] != want {
+			t.Errorf("%s counted %d, want %d", name, counters[name], want)
+		}
+	}
+	if gauges["wow.difficulty"] != "2" {
+		t.Errorf("difficulty gauge %q, want 2", gauges["wow.difficulty"])
+	}
+	if _, ok := gauges["wow.active_clients"]; !ok {
+		t.Error("no active clients gauge pushed")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// streamQuotes pushes a quote every SubscriptionInterval until the client
+// disconnects, a write fails or SubscriptionMaxDuration has passed
+func (s *WordOfWisdomServer) streamQuotes(conn net.Conn, reader *bufio.Reader, clientAddr string, logger *zap.Logger) {
+	// Subscribers only listen, so anything read, EOF included, ends the stream
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		logger.Error("set read deadline failed", zap.Error(err))
+	}
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+		_, _ = reader.ReadByte()
+	}()
+
+	ticker := time.NewTicker(s.config.SubscriptionInterval)
+	defer ticker.Stop()
+	end := time.NewTimer(s.config.SubscriptionMaxDuration)
+	defer end.Stop()
+
+	logger.Info("Subscription started", zap.String("client", clientAddr))
+
+	pushed := 0
+	for {
+		select {
+		case <-disconnected:
+			logger.Info("Subscriber disconnected", zap.String("client", clientAddr), zap.Int("quotes", pushed))
+
+			return
+		case <-end.C:
+			logger.Info("Subscription ended", zap.String("client", clientAddr), zap.Int("quotes", pushed))
+
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(s.limits().ConnectionTimeout)
+			if err := conn.SetWriteDeadline(deadline); err != nil {
+				logger.Error("set write deadline failed", zap.Error(err))
+			}
+			if err := s.sendQuote(conn, s.getRandomQuote(), deadline); err != nil {
+				// Subscribers usually go away by disconnecting
+				logger.Debug("Failed to push quote", zap.String("client", clientAddr), zap.Error(err))
+
+				return
+			}
+			pushed++
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSubscriptionPushesQuotesAtInterval(t *testing.T) {
+	const interval = 50 * time.Millisecond
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 1
+	cfg.SubscriptionInterval = interval
+	cfg.SubscriptionMaxDuration = 10 * interval
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, ok, err := solutionFor(t, s, line)
+	if err != nil || !ok {
+		t.Fatalf("no challenge in %q: %v", line, err)
+	}
+	if _, err := conn.Write([]byte(response + ";Subscribe:1\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// The quote for the solution, then one per interval until the duration
+	// is up and the server hangs up
+	var arrivals []time.Time
+	for {
+		quote, err := reader.ReadString('\n')
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil || !strings.HasPrefix(quote, "Quote:") {
+			t.Fatalf("read %q, %v; want a quote", quote, err)
+		}
+		arrivals = append(arrivals, time.Now())
+	}
+
+	if len(arrivals) < 5 {
+		t.Fatalf("received %d quotes over %s, want about one per %s", len(arrivals), cfg.SubscriptionMaxDuration, interval)
+	}
+	for i := 1; i < len(arrivals); i++ {
+		if gap := arrivals[i].Sub(arrivals[i-1]); gap < interval/2 || gap > 4*interval {
+			t.Errorf("quote %d pushed %s after the previous one, want about %s", i+1, gap, interval)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Outcomes of a connection reported in its summary
+const (
+	outcomeServed        = "served"
+	outcomeAuthenticated = "authenticated"
+	outcomeRejected      = "rejected"
+	outcomeMismatch      = "mismatch"
+	outcomeExpired       = "expired"
+	outcomeReused        = "reused"
+	outcomeLimited       = "limited"
+	outcomeBusy          = "busy"
+	outcomeInternalError = "internal_error"
+	outcomeNoResponse    = "no_response"
+	outcomeWriteFailed   = "write_failed"
+	outcomeOutOfOrder    = "out_of_order"
+)
+
+// countingConn is a connection counting the bytes read and written
+type countingConn struct {
+	net.Conn
+	read    atomic.Int64
+	written atomic.Int64
+}
+
+// Read reads from the connection, counting the bytes
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Add(int64(n))
+
+	return n, err
+}
+
+// Write writes to the connection, counting the bytes
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.Add(int64(n))
+
+	return n, err
+}
+
+// connSummary collects what happened on a connection to log it as a single
+// line when the connection ends; a nil summary collects nothing
+type connSummary struct {
+	id         uint64
+	start      time.Time
+	conn       *countingConn
+	challenges int
+	quotes     int
+	difficulty int
+	solveTime  time.Duration
+	outcome    string
+	err        error
+}
+
+// newConnSummary starts a summary of conn when summary logging is enabled,
+// returning the connection to use from then on
+func (s *WordOfWisdomServer) newConnSummary(conn net.Conn) (*connSummary, net.Conn) {
+	if !s.config.SummaryLogging {
+		return nil, conn
+	}
+
+	counting := &countingConn{Conn: conn}
+
+	return &connSummary{id: s.connIDs.Add(1), start: time.Now(), conn: counting}, counting
+}
+
+// challenge records a challenge issued at the given difficulty
+func (c *connSummary) challenge(difficulty int) {
+	if c == nil {
+		return
+	}
+
+	c.challenges++
+	c.difficulty = difficulty
+}
+
+// solved records the time the client took to answer the last challenge
+func (c *connSummary) solved(solveTime time.Duration) {
+	if c == nil {
+		return
+	}
+
+	c.solveTime = solveTime
+}
+
+// served records a quote sent to the client
+func (c *connSummary) served(outcome string) {
+	if c == nil {
+		return
+	}
+
+	c.quotes++
+	c.outcome = outcome
+}
+
+// end records why the connection is ending, along with the error if any
+func (c *connSummary) end(outcome string, err error) {
+	if c == nil {
+		return
+	}
+
+	c.outcome = outcome
+	c.err = err
+}
+
+// log logs the summary
+func (c *connSummary) log(logger *zap.Logger) {
+	if c == nil {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.Uint64("conn_id", c.id),
+		zap.String("client_ip", remoteIP(c.conn)),
+		zap.String("outcome", c.outcome),
+		zap.Int("challenges", c.challenges),
+		zap.Int("quotes", c.quotes),
+		zap.Int("difficulty", c.difficulty),
+		zap.Duration("solve_time", c.solveTime),
+		zap.Int64("bytes_read", c.conn.read.Load()),
+		zap.Int64("bytes_written", c.conn.written.Load()),
+		zap.Duration("duration", time.Since(c.start)),
+	}
+	if c.err != nil {
+		fields = append(fields, zap.NamedError("close_reason", c.err))
+	}
+
+	logger.Info("Connection summary", fields...)
+}
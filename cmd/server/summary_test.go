@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestConnectionSummaryOfServedClient(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MinDifficulty, cfg.MaxDifficulty = 2, 2
+	cfg.SummaryLogging = true
+	core, logs := observer.New(zapcore.InfoLevel)
+	s, listener := startLoopbackServer(t, cfg, zap.New(core))
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	quote, err := requestQuote(t, s, conn)
+	_ = conn.Close()
+	if err != nil || !strings.HasPrefix(quote, "Quote:") {
+		t.Fatalf("answered %q, %v; want a quote", quote, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("Connection summary").Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no connection summary logged")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	fields := logs.FilterMessage("Connection summary").All()[0].ContextMap()
+
+	for _, key := range []string{"conn_id", "client_ip", "solve_time", "duration"} {
+		if _, ok := fields[key]; !ok {
+			t.Errorf("summary lacks %s: %v", key, fields)
+		}
+	}
+	if _, ok := fields["close_reason"]; ok {
+		t.Errorf("served client has a close reason: %v", fields)
+	}
+	want := map[string]any{
+		"outcome":    outcomeServed,
+		"challenges": int64(1),
+		"quotes":     int64(1),
+		"difficulty": int64(2),
+	}
+	for key, value := range want {
+		if fields[key] != value {
+			t.Errorf("summary %s is %v, want %v", key, fields[key], value)
+		}
+	}
+	for _, key := range []string{"bytes_read", "bytes_written"} {
+		if bytes, _ := fields[key].(int64); bytes <= 0 {
+			t.Errorf("summary %s is %v, want the bytes transferred", key, fields[key])
+		}
+	}
+}
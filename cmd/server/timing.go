@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// phaseTimer measures the time spent in consecutive phases of handling a
+// challenge; a nil timer measures nothing
+type phaseTimer struct {
+	start  time.Time
+	last   time.Time
+	phases []zap.Field
+}
+
+// newPhaseTimer starts a timer when timing is enabled, returning nil otherwise
+func newPhaseTimer(enabled bool) *phaseTimer {
+	if !enabled {
+		return nil
+	}
+
+	now := time.Now()
+
+	return &phaseTimer{start: now, last: now}
+}
+
+// mark ends the named phase, which started when the previous one ended
+func (t *phaseTimer) mark(phase string) {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	t.phases = append(t.phases, zap.Duration(phase, now.Sub(t.last)))
+	t.last = now
+}
+
+// log logs the phases measured so far along with the total time
+func (t *phaseTimer) log(logger *zap.Logger, clientAddr string) {
+	if t == nil {
+		return
+	}
+
+	fields := append([]zap.Field{zap.String("client", clientAddr), zap.Duration("total", time.Since(t.start))}, t.phases...)
+	logger.Info("Challenge timing", fields...)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTimingBreakdown(t *testing.T) {
+	cfg := testServerConfig()
+	cfg.MaxDifficulty = 1
+	cfg.LogTimings = true
+	core, logs := observer.New(zapcore.InfoLevel)
+	s, listener := startLoopbackServer(t, cfg, zap.New(core))
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The client takes a while, which must show up as waiting for it
+	const think = 100 * time.Millisecond
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, ok, err := solutionFor(t, s, line)
+	if err != nil || !ok {
+		t.Fatalf("no challenge in %q: %v", line, err)
+	}
+	time.Sleep(think)
+	if _, err := conn.Write([]byte(response + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if answer, err := reader.ReadString('\n'); err != nil || !strings.HasPrefix(answer, "Quote:") {
+		t.Fatalf("answered %q, %v; want a quote", answer, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("Challenge timing").Len() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no timing breakdown logged")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	fields := logs.FilterMessage("Challenge timing").All()[0].ContextMap()
+
+	var sum time.Duration
+	for _, phase := range []string{"generate", "send_challenge", "wait_response", "verify", "send_quote"} {
+		duration, ok := fields[phase].(time.Duration)
+		if !ok {
+			t.Fatalf("phase %s missing from %v", phase, fields)
+		}
+		sum += duration
+	}
+	total, ok := fields["total"].(time.Duration)
+	if !ok {
+		t.Fatalf("total missing from %v", fields)
+	}
+	if sum > total || total-sum > 50*time.Millisecond {
+		t.Errorf("phases add up to %s, total %s", sum, total)
+	}
+	if wait := fields["wait_response"].(time.Duration); wait < think {
+		t.Errorf("waited %s for the response, the client took %s", wait, think)
+	}
+}
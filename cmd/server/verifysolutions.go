@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/recording"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/replay"
+	"go.uber.org/zap"
+)
+
+// VerifyRecording replays the solutions recorded at path against the server,
+// checking that each still verifies with the server's data layout, namespace
+// and nonce encoding at its recorded difficulty. Recorded solutions are long
+// expired, so their time window and clock skew aren't checked. It returns the
+// number of solutions and how many of them failed
+func (s *WordOfWisdomServer) VerifyRecording(path string) (int, int, error) {
+	solutions, err := recording.Read(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	failed := 0
+	for _, solution := range solutions {
+		issued := replay.Challenge{Timestamp: solution.Timestamp, Difficulty: solution.Difficulty, Purpose: solution.Purpose}
+		format := solution.TimestampFormat
+		if format == "" {
+			format = s.config.HashTimestampFormat
+		}
+
+		err := s.checkHash(context.Background(), solution.Challenge, issued, solution.Nonce, format, solution.Difficulty, s.logger)
+		if err != nil {
+			s.logger.Error("Solution no longer verifies",
+				zap.String("challenge", solution.Challenge),
+				zap.String("nonce", solution.Nonce),
+				zap.Int("difficulty", solution.Difficulty),
+				zap.Error(err),
+			)
+			failed++
+		}
+	}
+
+	return len(solutions), failed, nil
+}
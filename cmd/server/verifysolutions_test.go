@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/config"
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/recording"
+	"go.uber.org/zap"
+)
+
+// reversedLayout hashes the parts of a solution back to front
+func reversedLayout(challenge, nonce, timestamp string, extras ...string) []byte {
+	return []byte(strings.Join(extras, "") + timestamp + nonce + challenge)
+}
+
+// recordExchange serves a single exchange with cfg, recording the accepted
+// solutions to path, and returns the server's answer
+func recordExchange(t *testing.T, cfg config.ServerConfig, path string) string {
+	t.Helper()
+
+	recorder, err := recording.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = recorder.Close()
+	}()
+
+	s, listener := startLoopbackServer(t, cfg, zap.NewNop())
+	s.UseRecorder(recorder)
+	s.UseDataLayout(reversedLayout)
+
+	conn, err := listener.Dial(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	answer, err := requestQuote(t, s, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return answer
+}
+
+func TestRecordAndReplaySolution(t *testing.T) {
+	// At difficulty 1 a solution would often hold for another layout too
+	cfg := testServerConfig()
+	cfg.MinDifficulty, cfg.MaxDifficulty = 4, 4
+
+	path := filepath.Join(t.TempDir(), "solutions.jsonl")
+	if answer := recordExchange(t, cfg, path); !strings.HasPrefix(answer, "Quote:") {
+		t.Fatalf("expected a quote, got %q", answer)
+	}
+
+	// A fresh server hashing the same way accepts the recorded solution
+	fresh := NewServer(cfg, zap.NewNop())
+	fresh.UseDataLayout(reversedLayout)
+	total, failed, err := fresh.VerifyRecording(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 || failed != 0 {
+		t.Errorf("replayed %d solutions with %d failures, want 1 without failures", total, failed)
+	}
+
+	// A server hashing another way doesn't
+	changed := NewServer(cfg, zap.NewNop())
+	if _, failed, _ := changed.VerifyRecording(path); failed != 1 {
+		t.Errorf("got %d failures after changing the layout, want 1", failed)
+	}
+}
+
+func TestRejectedSolutionsAreNotRecorded(t *testing.T) {
+	// Every solution is implausibly fast for so slow a client
+	cfg := testServerConfig()
+	cfg.FastSolveHashRate = 0.001
+	cfg.FastSolveFraction = 0.5
+	cfg.RejectFastSolves = true
+
+	path := filepath.Join(t.TempDir(), "solutions.jsonl")
+	if answer := recordExchange(t, cfg, path); !strings.HasPrefix(answer, "Error:") {
+		t.Fatalf("expected the solution to be rejected, got %q", answer)
+	}
+
+	solutions, err := recording.Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(solutions) != 0 {
+		t.Errorf("recorded %d rejected solutions", len(solutions))
+	}
+}
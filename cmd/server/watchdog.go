@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// markAccepted records that a connection was accepted, whether it was
+// handled or turned away
+func (s *WordOfWisdomServer) markAccepted() {
+	s.lastAccept.Store(time.Now().UnixNano())
+}
+
+// watchAccepts logs whenever no connection was accepted for longer than
+// AcceptWatchdogInterval until ctx is done. Quiet periods are logged at debug
+// level; only an accept loop that is failing or not waiting in Accept, i.e.
+// a wedged listener, is warned about
+func (s *WordOfWisdomServer) watchAccepts(ctx context.Context) {
+	defer s.crashOnPanic("accept watchdog")
+
+	s.markAccepted()
+
+	ticker := time.NewTicker(s.config.AcceptWatchdogInterval)
+	defer ticker.Stop()
+
+	// The accept loop only counts as stuck outside Accept when it was there
+	// on two ticks in a row, not while starting up
+	outside := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			failures := s.acceptFailures.Swap(0)
+			wasOutside := outside
+			outside = !s.accepting.Load()
+			idle := now.Sub(time.Unix(0, s.lastAccept.Load()))
+			if idle <= s.config.AcceptWatchdogInterval {
+				continue
+			}
+
+			if failures > 0 || outside && wasOutside {
+				s.logger.Warn("No connection accepted recently, the listener is stuck",
+					zap.Duration("idle", idle), zap.Int64("accept_failures", failures))
+			} else {
+				s.logger.Debug("No connection accepted recently", zap.Duration("idle", idle))
+			}
+		}
+	}
+}
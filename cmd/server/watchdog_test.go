@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/loopback"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// failingListener fails its first Accept, as a listener out of file
+// descriptors does
+type failingListener struct {
+	*loopback.Listener
+	failed atomic.Bool
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	if l.failed.CompareAndSwap(false, true) {
+		return nil, errors.New("too many open files")
+	}
+
+	return l.Listener.Accept()
+}
+
+// watchListener serves on listener with a fast watchdog, returning what was
+// logged over a few of its intervals
+func watchListener(t *testing.T, listener net.Listener) *observer.ObservedLogs {
+	t.Helper()
+
+	cfg := testServerConfig()
+	cfg.AcceptWatchdogInterval = 10 * time.Millisecond
+	core, logs := observer.New(zapcore.DebugLevel)
+	s := NewServer(cfg, zap.New(core))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = s.Serve(listener)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	_ = listener.Close()
+	<-done
+
+	return logs
+}
+
+func TestAcceptWatchdogIdleIsDebug(t *testing.T) {
+	logs := watchListener(t, loopback.NewListener())
+
+	idle := logs.FilterMessage("No connection accepted recently").All()
+	if len(idle) == 0 {
+		t.Fatal("quiet period not logged")
+	}
+	if idle[0].Level != zapcore.DebugLevel {
+		t.Errorf("quiet period logged at %s, want debug", idle[0].Level)
+	}
+	if stuck := logs.FilterLevelExact(zapcore.WarnLevel).Len(); stuck != 0 {
+		t.Errorf("idle listener warned about %d times: %v", stuck, logs.FilterLevelExact(zapcore.WarnLevel).All())
+	}
+}
+
+func TestAcceptWatchdogWarnsWhenStuck(t *testing.T) {
+	logs := watchListener(t, &failingListener{Listener: loopback.NewListener()})
+
+	if logs.FilterMessage("No connection accepted recently, the listener is stuck").Len() == 0 {
+		t.Errorf("failing listener not warned about: %v", logs.All())
+	}
+}
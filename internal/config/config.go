@@ -1,13 +1,121 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+	"go.uber.org/zap/zapcore"
 	"gopkg.in/yaml.v3"
 )
 
+// Bounds and default of the connection read buffer size; a message must fit in
+// the buffer to be read
+const (
+	DefaultReadBufferBytes = 4096
+	MinReadBufferBytes     = 256
+	MaxReadBufferBytes     = 1 << 20
+)
+
+// Defaults of the load metrics
+const (
+	// DefaultSharedLoadInterval is how often the shared load is refreshed
+	DefaultSharedLoadInterval = time.Second
+	// DefaultRateWindow is the window the request rate is averaged over
+	DefaultRateWindow = 10 * time.Second
+)
+
+// namespaceChars are the characters a challenge namespace may hold
+const namespaceChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
+
+// Defaults of the StatsD push
+const (
+	DefaultStatsDInterval = 10 * time.Second
+	DefaultStatsDPrefix   = "wow"
+)
+
+// DefaultListenRetryDelay is how long the server waits before binding its
+// port again while it is in use
+const DefaultListenRetryDelay = time.Second
+
+// DefaultSubscriptionMaxDuration is how long a quote subscription lasts
+// unless configured otherwise
+const DefaultSubscriptionMaxDuration = time.Hour
+
+// DefaultShutdownGracePeriod is how long connections in flight may finish on
+// shutdown unless configured otherwise, well within the 10s container
+// runtimes usually allow before killing the process
+const DefaultShutdownGracePeriod = 5 * time.Second
+
+// DefaultMaxMessageBytes is the longest message the client reassembles from
+// the server unless configured otherwise
+const DefaultMaxMessageBytes = 1 << 20
+
+// DefaultClientMaxDifficulty is the hardest challenge the client solves
+// unless configured otherwise, about 4 billion hashes on average
+const DefaultClientMaxDifficulty = 8
+
+// Metrics the difficulty can follow
+const (
+	// DifficultyMetricConcurrency follows the number of connected clients
+	DifficultyMetricConcurrency = "concurrency"
+	// DifficultyMetricRate follows the number of requests per second
+	DifficultyMetricRate = "rate"
+)
+
+// Default loads above which the difficulty is raised, in connected clients
+// for the concurrency metric and in requests per second for the rate metric
+const (
+	DefaultConcurrencyMidLoad = 20
+	DefaultConcurrencyMaxLoad = 50
+	DefaultRateMidLoad        = 100
+	DefaultRateMaxLoad        = 250
+)
+
+// Policies for answering a client response that can't be parsed
+const (
+	// MalformedResponseGeneric sends a generic error
+	MalformedResponseGeneric = "generic"
+	// MalformedResponseHint sends an error describing the expected format
+	MalformedResponseHint = "hint"
+	// MalformedResponseDrop closes the connection without a reply
+	MalformedResponseDrop = "drop"
+)
+
+// Policies for a quotes file holding more than the allowed number of quotes
+const (
+	// QuotesOverflowTruncate keeps the first quotes and logs a warning
+	QuotesOverflowTruncate = "truncate"
+	// QuotesOverflowError fails loading the quotes
+	QuotesOverflowError = "error"
+)
+
+// Sources of the quotes served
+const (
+	// QuotesSourceBuiltin serves the handful of quotes built into the server
+	QuotesSourceBuiltin = "builtin"
+	// QuotesSourceFile serves the quotes from QuotesFile
+	QuotesSourceFile = "file"
+	// QuotesSourceEmbedded serves the quotes compiled in from
+	// internal/quotes/quotes.txt, for single-binary deployments
+	QuotesSourceEmbedded = "embedded"
+)
+
+// Preset is a named bundle of difficulty settings the server can switch to
+// at runtime
+type Preset struct {
+	MinDifficulty     int           `yaml:"min_difficulty"`
+	MaxDifficulty     int           `yaml:"max_difficulty"`
+	ConnectionTimeout time.Duration `yaml:"conn_timeout"`
+}
+
 // ServerConfig defines the configuration for the server
 type ServerConfig struct {
 	Host              string        `yaml:"host"`
@@ -17,6 +125,271 @@ type ServerConfig struct {
 	TimeWindow        time.Duration `yaml:"time_window"`
 	MinDifficulty     int           `yaml:"min_difficulty"`
 	MaxDifficulty     int           `yaml:"max_difficulty"`
+	// HysteresisSamples is the number of consecutive load samples that must
+	// agree before the difficulty is changed
+	HysteresisSamples int `yaml:"hysteresis_samples"`
+	// HysteresisMargin is how far below a raise threshold the load must fall
+	// before the difficulty is lowered again
+	HysteresisMargin int `yaml:"hysteresis_margin"`
+	// HTTPAddress enables the HTTP gateway on the given address when set
+	HTTPAddress string `yaml:"http_address"`
+	// MaxClockSkew is how far the client's timestamp may be off from the
+	// server's clock in either direction; TimeWindow is used when unset
+	MaxClockSkew time.Duration `yaml:"max_clock_skew"`
+	// LogFile makes the server log to the given file instead of stderr; the
+	// file is reopened on SIGUSR1 to support external log rotation
+	LogFile string `yaml:"log_file"`
+	// MalformedResponsePolicy is one of generic (default), hint or drop
+	MalformedResponsePolicy string `yaml:"malformed_response_policy"`
+	// ReadBufferBytes is the size of the connection read buffer
+	ReadBufferBytes int `yaml:"read_buffer_bytes"`
+	// RequireChallengeEcho rejects responses that don't echo the issued challenge
+	RequireChallengeEcho bool `yaml:"require_challenge_echo"`
+	// QuotesFile is a file with one quote per line replacing the built-in quotes
+	QuotesFile string `yaml:"quotes_file"`
+	// MaxQuotes caps the number of quotes loaded from QuotesFile, 0 means no cap
+	MaxQuotes int `yaml:"max_quotes"`
+	// QuotesOverflowPolicy is truncate (default) or error, deciding what
+	// happens when QuotesFile holds more than MaxQuotes quotes
+	QuotesOverflowPolicy string `yaml:"quotes_overflow_policy"`
+	// ChallengeSendJitter is the upper bound of a random delay before sending
+	// the challenge, spreading out bursts of clients
+	ChallengeSendJitter time.Duration `yaml:"challenge_send_jitter"`
+	// ReplayStorePath makes the issued challenges survive restarts by
+	// persisting them to the given file instead of keeping them in memory;
+	// the file is rewritten on SIGUSR1, like LogFile is reopened
+	ReplayStorePath string `yaml:"replay_store_path"`
+	// SharedLoadURL is an HTTP endpoint aggregating the load of all instances;
+	// when set the difficulty follows the aggregated load
+	SharedLoadURL string `yaml:"shared_load_url"`
+	// SharedLoadInterval is how often the aggregated load is refreshed
+	SharedLoadInterval time.Duration `yaml:"shared_load_interval"`
+	// Honeypot serves a quote to every client that responds, mismatched and
+	// replayed responses included, and only logs whether its PoW was valid.
+	// This is insecure and meant for research only
+	Honeypot bool `yaml:"honeypot"`
+	// DifficultyMetric is the load the difficulty follows: concurrency
+	// (default), the number of connected clients, or rate, the number of
+	// requests per second averaged over RateWindow
+	DifficultyMetric string `yaml:"difficulty_metric"`
+	// MidDifficultyLoad and MaxDifficultyLoad are the loads, in the unit of
+	// DifficultyMetric, above which the difficulty is raised to one below
+	// MaxDifficulty and to MaxDifficulty; they default per metric
+	MidDifficultyLoad int `yaml:"mid_difficulty_load"`
+	MaxDifficultyLoad int `yaml:"max_difficulty_load"`
+	// RateWindow is the window the request rate is averaged over
+	RateWindow time.Duration `yaml:"rate_window"`
+	// KeepAlive answers client pings sent while solving, each restarting the
+	// connection timeout, so idle timeouts along the way don't drop long solves
+	KeepAlive bool `yaml:"keepalive"`
+	// MaxConcurrentPerIP caps the simultaneous connections from a single IP,
+	// 0 means no cap
+	MaxConcurrentPerIP int `yaml:"max_concurrent_per_ip"`
+	// FastSolveHashRate is the hash rate, in hashes per second, of the
+	// fastest plausible client; solutions taking less than FastSolveFraction
+	// of the time it would need are flagged. Either being 0 disables the check
+	FastSolveHashRate float64 `yaml:"fast_solve_hash_rate"`
+	FastSolveFraction float64 `yaml:"fast_solve_fraction"`
+	// RejectFastSolves rejects the flagged solutions instead of only logging them
+	RejectFastSolves bool `yaml:"reject_fast_solves"`
+	// AuthTokens maps client identities to pre-shared tokens; a client
+	// presenting one of the tokens is served without solving a challenge.
+	// Once set, every client must open with an authentication line
+	AuthTokens map[string]string `yaml:"auth_tokens"`
+	// RecordSolutionsPath records every accepted solution to the given file,
+	// building a corpus for the server's -verify-solutions; the file is
+	// reopened on SIGUSR1, like LogFile
+	RecordSolutionsPath string `yaml:"record_solutions_path"`
+	// Presets are named difficulty settings replacing min_difficulty,
+	// max_difficulty and conn_timeout; Preset is the one active at startup,
+	// the top-level settings are used when it is empty
+	Presets map[string]Preset `yaml:"presets"`
+	Preset  string            `yaml:"preset"`
+	// AdminAddress enables the admin HTTP endpoints on the given address when
+	// set; it must not be reachable by clients
+	AdminAddress string `yaml:"admin_address"`
+	// MaxChainedChallenges is how many more challenges a client may ask for
+	// on the same connection, each sent right after the previous quote; 0
+	// disables chaining
+	MaxChainedChallenges int `yaml:"max_chained_challenges"`
+	// IdleTimeout closes connections that made no progress for that long,
+	// checked in the background as a safety net for connections whose
+	// deadlines didn't fire; 0 disables it. Without keepalive it must exceed
+	// the longest expected solve
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// LogTimings logs how long each phase of every challenge took: generating,
+	// sending, waiting for the response, verifying and sending the quote
+	LogTimings bool `yaml:"log_timings"`
+	// SLAMaxSolveTime caps the advertised difficulty, whatever the other
+	// settings, to the highest one this machine solves within that time on
+	// average, measured at startup; 0 disables the cap
+	SLAMaxSolveTime time.Duration `yaml:"sla_max_solve_time"`
+	// Dashboard serves a page with the live server state at the root of
+	// AdminAddress
+	Dashboard bool `yaml:"dashboard"`
+	// Purpose binds the challenges issued over TCP to a use, e.g. signup, so
+	// that their solutions can't be reused for another; it is hashed along
+	// with the challenge and must be echoed by the client
+	Purpose string `yaml:"purpose"`
+	// AcceptWatchdogInterval logs whenever no connection was accepted for
+	// that long, warning when the listener is stuck rather than idle; 0
+	// disables it
+	AcceptWatchdogInterval time.Duration `yaml:"accept_watchdog_interval"`
+	// MinNonceLikelihood flags numeric nonces so small that a search from 0
+	// would have found them with a lower likelihood at their difficulty; 0
+	// disables the check
+	MinNonceLikelihood float64 `yaml:"min_nonce_likelihood"`
+	// RejectUnlikelyNonces rejects the flagged nonces instead of only logging them
+	RejectUnlikelyNonces bool `yaml:"reject_unlikely_nonces"`
+	// Banner is a line, e.g. WOW-PoW/1, sent to every client before anything
+	// else to identify the protocol; no banner is sent when empty
+	Banner string `yaml:"banner"`
+	// VerboseErrors tells clients why their solution was rejected, along
+	// with the server time for timestamp issues; meant for debugging only
+	VerboseErrors bool `yaml:"verbose_errors"`
+	// SubscriptionInterval, when set, lets clients that solved a challenge
+	// subscribe to a quote pushed every interval over the same connection
+	SubscriptionInterval time.Duration `yaml:"subscription_interval"`
+	// SubscriptionMaxDuration caps how long a subscription lasts
+	SubscriptionMaxDuration time.Duration `yaml:"subscription_max_duration"`
+	// VerifyTimeout, when set, fails solutions whose verification takes
+	// longer, guarding against schemes that are expensive to verify
+	VerifyTimeout time.Duration `yaml:"verify_timeout"`
+	// SummaryLogging logs a single line summing up every connection when
+	// it ends, in addition to the detailed logs
+	SummaryLogging bool `yaml:"summary_logging"`
+	// HashTimestampFormat is how the challenge timestamp is hashed, either
+	// rfc3339nano (the default) or epoch_nanos; clients must use the same
+	HashTimestampFormat pow.TimestampFormat `yaml:"hash_timestamp_format"`
+	// NonceEncoding is how nonces are written, decimal (the default), hex or
+	// base64; it is announced with every challenge
+	NonceEncoding pow.NonceEncoding `yaml:"nonce_encoding"`
+	// ListenRetries is how many more times binding the port is tried while
+	// it is in use, ListenRetryDelay apart
+	ListenRetries    int           `yaml:"listen_retries"`
+	ListenRetryDelay time.Duration `yaml:"listen_retry_delay"`
+	// StrictOrdering rejects clients sending anything but an authentication
+	// token before they were sent their challenge
+	StrictOrdering bool `yaml:"strict_ordering"`
+	// QuoteBucket, when set, serves the same quote to everyone within each
+	// bucket of time, e.g. 24h for a quote of the day
+	QuoteBucket time.Duration `yaml:"quote_bucket"`
+	// StatsDAddress, when set, is the host:port of a StatsD server the stats
+	// are pushed to every StatsDInterval, named after StatsDPrefix
+	StatsDAddress  string        `yaml:"statsd_address"`
+	StatsDInterval time.Duration `yaml:"statsd_interval"`
+	StatsDPrefix   string        `yaml:"statsd_prefix"`
+	// MaxDifficultyStep, when set, limits how much the difficulty changes
+	// between successive adjustments, smoothing the ramp under load spikes
+	MaxDifficultyStep int `yaml:"max_difficulty_step"`
+	// QuotesSource is builtin, file or embedded; it defaults to file when
+	// QuotesFile is set and to builtin otherwise
+	QuotesSource string `yaml:"quotes_source"`
+	// TimeWindowPerDifficulty extends TimeWindow by this much per difficulty
+	// level of the challenge, as harder challenges take longer to solve
+	TimeWindowPerDifficulty time.Duration `yaml:"time_window_per_difficulty"`
+	// ShutdownGracePeriod is how long connections in flight may still submit
+	// their solutions once shutdown begins; they are closed afterwards. It
+	// is DefaultShutdownGracePeriod when unset, an explicit 0 closes them
+	// right away
+	ShutdownGracePeriod *time.Duration `yaml:"shutdown_grace_period"`
+	// ChallengeNamespace, when set, prefixes every challenge, e.g. with the
+	// tenant the server serves, so that solutions for challenges issued in
+	// another namespace are rejected
+	ChallengeNamespace string `yaml:"challenge_namespace"`
+	// QuoteChunkBytes, when set, makes quotes be written in chunks of at most
+	// that many bytes, each of which must be written within ConnectionTimeout
+	QuoteChunkBytes int `yaml:"quote_chunk_bytes"`
+	// DebugFilter lists IPs and CIDRs whose connections are logged at debug
+	// level in full detail, whatever the server's log level
+	DebugFilter []string `yaml:"debug_filter"`
+}
+
+// MarshalLogObject logs the effective server settings; secret settings must
+// never be logged in clear text here
+func (c ServerConfig) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("host", c.Host)
+	enc.AddInt("port", c.Port)
+	enc.AddInt("max_connections", c.MaxConnections)
+	enc.AddDuration("conn_timeout", c.ConnectionTimeout)
+	enc.AddDuration("time_window", c.TimeWindow)
+	enc.AddDuration("max_clock_skew", c.MaxClockSkew)
+	enc.AddInt("min_difficulty", c.MinDifficulty)
+	enc.AddInt("max_difficulty", c.MaxDifficulty)
+	enc.AddInt("hysteresis_samples", c.HysteresisSamples)
+	enc.AddInt("hysteresis_margin", c.HysteresisMargin)
+	enc.AddString("http_address", c.HTTPAddress)
+	enc.AddString("log_file", c.LogFile)
+	enc.AddString("malformed_response_policy", c.MalformedResponsePolicy)
+	enc.AddInt("read_buffer_bytes", c.ReadBufferBytes)
+	enc.AddBool("require_challenge_echo", c.RequireChallengeEcho)
+	enc.AddString("quotes_file", c.QuotesFile)
+	enc.AddInt("max_quotes", c.MaxQuotes)
+	enc.AddString("quotes_overflow_policy", c.QuotesOverflowPolicy)
+	enc.AddDuration("challenge_send_jitter", c.ChallengeSendJitter)
+	enc.AddString("replay_store_path", c.ReplayStorePath)
+	enc.AddString("shared_load_url", redactURL(c.SharedLoadURL))
+	enc.AddDuration("shared_load_interval", c.SharedLoadInterval)
+	enc.AddBool("honeypot", c.Honeypot)
+	enc.AddString("difficulty_metric", c.DifficultyMetric)
+	enc.AddInt("mid_difficulty_load", c.MidDifficultyLoad)
+	enc.AddInt("max_difficulty_load", c.MaxDifficultyLoad)
+	enc.AddDuration("rate_window", c.RateWindow)
+	enc.AddBool("keepalive", c.KeepAlive)
+	enc.AddInt("max_concurrent_per_ip", c.MaxConcurrentPerIP)
+	enc.AddFloat64("fast_solve_hash_rate", c.FastSolveHashRate)
+	enc.AddFloat64("fast_solve_fraction", c.FastSolveFraction)
+	enc.AddBool("reject_fast_solves", c.RejectFastSolves)
+	enc.AddInt("auth_tokens", len(c.AuthTokens))
+	enc.AddString("record_solutions_path", c.RecordSolutionsPath)
+	enc.AddInt("presets", len(c.Presets))
+	enc.AddString("preset", c.Preset)
+	enc.AddString("admin_address", c.AdminAddress)
+	enc.AddInt("max_chained_challenges", c.MaxChainedChallenges)
+	enc.AddDuration("idle_timeout", c.IdleTimeout)
+	enc.AddBool("log_timings", c.LogTimings)
+	enc.AddDuration("sla_max_solve_time", c.SLAMaxSolveTime)
+	enc.AddBool("dashboard", c.Dashboard)
+	enc.AddString("purpose", c.Purpose)
+	enc.AddDuration("accept_watchdog_interval", c.AcceptWatchdogInterval)
+	enc.AddFloat64("min_nonce_likelihood", c.MinNonceLikelihood)
+	enc.AddBool("reject_unlikely_nonces", c.RejectUnlikelyNonces)
+	enc.AddString("banner", c.Banner)
+	enc.AddBool("verbose_errors", c.VerboseErrors)
+	enc.AddDuration("subscription_interval", c.SubscriptionInterval)
+	enc.AddDuration("subscription_max_duration", c.SubscriptionMaxDuration)
+	enc.AddDuration("verify_timeout", c.VerifyTimeout)
+	enc.AddBool("summary_logging", c.SummaryLogging)
+	enc.AddString("hash_timestamp_format", string(c.HashTimestampFormat))
+	enc.AddString("nonce_encoding", string(c.NonceEncoding))
+	enc.AddInt("listen_retries", c.ListenRetries)
+	enc.AddDuration("listen_retry_delay", c.ListenRetryDelay)
+	enc.AddBool("strict_ordering", c.StrictOrdering)
+	enc.AddDuration("quote_bucket", c.QuoteBucket)
+	enc.AddString("statsd_address", c.StatsDAddress)
+	enc.AddDuration("statsd_interval", c.StatsDInterval)
+	enc.AddString("statsd_prefix", c.StatsDPrefix)
+	enc.AddInt("max_difficulty_step", c.MaxDifficultyStep)
+	enc.AddString("quotes_source", c.QuotesSource)
+	enc.AddDuration("time_window_per_difficulty", c.TimeWindowPerDifficulty)
+	if c.ShutdownGracePeriod != nil {
+		enc.AddDuration("shutdown_grace_period", *c.ShutdownGracePeriod)
+	}
+	enc.AddString("challenge_namespace", c.ChallengeNamespace)
+	enc.AddInt("quote_chunk_bytes", c.QuoteChunkBytes)
+	enc.AddString("debug_filter", strings.Join(c.DebugFilter, ","))
+
+	return nil
+}
+
+// redactURL hides the password a URL may carry
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "<invalid>"
+	}
+
+	return u.Redacted()
 }
 
 // ClientConfig defines the configuration for the client
@@ -24,6 +397,60 @@ type ClientConfig struct {
 	ServerAddress     string        `yaml:"server_address"`
 	ConnectionTimeout time.Duration `yaml:"conn_timeout"`
 	MaxNonce          int           `yaml:"max_nonce"`
+	// Requests is the number of exchanges to run as a batch; a single
+	// exchange is run when it is 1 or less
+	Requests int `yaml:"requests"`
+	// Concurrency is the number of exchanges of a batch run in parallel
+	Concurrency int `yaml:"concurrency"`
+	// SolveHistogram reports solve time percentiles at the end of a batch
+	SolveHistogram bool `yaml:"solve_histogram"`
+	// ReadBufferBytes is the size of the connection read buffer
+	ReadBufferBytes int `yaml:"read_buffer_bytes"`
+	// MaxMessageBytes is the longest message accepted from the server,
+	// reassembled when it doesn't fit the read buffer
+	MaxMessageBytes int `yaml:"max_message_bytes"`
+	// MaxDifficulty is the hardest challenge the client agrees to solve, so
+	// that a hostile server can't keep it grinding forever
+	MaxDifficulty int `yaml:"max_difficulty"`
+	// SubscribeDuration is how long the client stays subscribed at most
+	SubscribeDuration time.Duration `yaml:"subscribe_duration"`
+	// MaxRetries is the number of times a failed exchange is retried
+	MaxRetries int `yaml:"max_retries"`
+	// RetryBackoff is the delay before retrying a failed exchange
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	// KeepAliveInterval is how often a ping is sent while solving, the server
+	// must have keepalive enabled; 0 disables pings
+	KeepAliveInterval time.Duration `yaml:"keepalive_interval"`
+	// AuthToken is sent to the server before the challenge to skip solving it
+	AuthToken string `yaml:"auth_token"`
+	// DeterministicNonceStart searches nonces sequentially from 0 on a single
+	// core instead of in parallel from a random start, so that a challenge
+	// always yields the same nonce; meant for debugging
+	DeterministicNonceStart bool `yaml:"deterministic_nonce_start"`
+	// ChainedRequests is the number of quotes fetched over a single
+	// connection, the server must allow chaining; it is ignored when 1 or less
+	ChainedRequests int `yaml:"chained_requests"`
+	// SRVRecord is a DNS SRV record, e.g. _wow._tcp.example.com, listing the
+	// servers to connect to instead of ServerAddress
+	SRVRecord string `yaml:"srv_record"`
+	// ExpectedBanner, when set, must be the banner the server sends first;
+	// otherwise a banner is accepted but not required
+	ExpectedBanner string `yaml:"expected_banner"`
+	// SolverWorkers caps the goroutines solving challenges across all
+	// concurrent requests, one per CPU when 0
+	SolverWorkers int `yaml:"solver_workers"`
+	// Subscribe makes the client stay connected after its quote and receive
+	// the quotes the server pushes periodically
+	Subscribe bool `yaml:"subscribe"`
+	// HashTimestampFormat is how the challenge timestamp is hashed, it must
+	// match the server's
+	HashTimestampFormat pow.TimestampFormat `yaml:"hash_timestamp_format"`
+	// ResponseTimeout, when set, bounds the wait for the server's answer
+	// after the solution was sent, failing sooner than ConnectionTimeout
+	ResponseTimeout time.Duration `yaml:"response_timeout"`
+	// Software, when set, identifies the client software to the server, e.g.
+	// my-client/1.2, for its logs
+	Software string `yaml:"software"`
 }
 
 // AppConfig is the top-level structure to hold all configurations
@@ -34,15 +461,295 @@ type AppConfig struct {
 
 // LoadConfig reads and parses the YAML configuration file
 func LoadConfig(path string) (*AppConfig, error) {
-	data, err := os.ReadFile(path)
+	data, err := readConfigFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, err
 	}
 
 	var config AppConfig
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal config %s: %w", path, describeUnmarshalError(data, err))
+	}
+
+	config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
 	}
 
 	return &config, nil
 }
+
+// readConfigFile reads the config file at path, explaining the usual
+// mistakes: a directory, a file that can't be read and an empty file, which
+// would otherwise yield a config of zero values
+func readConfigFile(path string) ([]byte, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil, fmt.Errorf("config path %s is a directory, expected a YAML file", path)
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, fmt.Errorf("config file %s not found: %w", path, err)
+	case errors.Is(err, fs.ErrPermission):
+		return nil, fmt.Errorf("permission denied reading config %s, check the file's owner and mode: %w", path, err)
+	case err != nil:
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("config file %s is empty", path)
+	}
+
+	return data, nil
+}
+
+// applyDefaults fills in the settings left unset
+func (c *AppConfig) applyDefaults() {
+	c.Server.ApplyDefaults()
+	c.Client.ApplyDefaults()
+}
+
+// ApplyDefaults fills in the client settings left unset, for configs built
+// in code rather than loaded with LoadConfig
+func (c *ClientConfig) ApplyDefaults() {
+	if c.ReadBufferBytes == 0 {
+		c.ReadBufferBytes = DefaultReadBufferBytes
+	}
+	if c.MaxMessageBytes == 0 {
+		c.MaxMessageBytes = DefaultMaxMessageBytes
+	}
+	if c.MaxDifficulty == 0 {
+		c.MaxDifficulty = DefaultClientMaxDifficulty
+	}
+	if c.SubscribeDuration == 0 {
+		c.SubscribeDuration = DefaultSubscriptionMaxDuration
+	}
+}
+
+// ApplyDefaults fills in the server settings left unset, for configs built
+// in code rather than loaded with LoadConfig
+func (c *ServerConfig) ApplyDefaults() {
+	if c.ReadBufferBytes == 0 {
+		c.ReadBufferBytes = DefaultReadBufferBytes
+	}
+	if c.SharedLoadInterval == 0 {
+		c.SharedLoadInterval = DefaultSharedLoadInterval
+	}
+	if c.RateWindow == 0 {
+		c.RateWindow = DefaultRateWindow
+	}
+	if c.QuotesSource == "" && c.QuotesFile != "" {
+		c.QuotesSource = QuotesSourceFile
+	} else if c.QuotesSource == "" {
+		c.QuotesSource = QuotesSourceBuiltin
+	}
+	if c.StatsDInterval == 0 {
+		c.StatsDInterval = DefaultStatsDInterval
+	}
+	if c.StatsDPrefix == "" {
+		c.StatsDPrefix = DefaultStatsDPrefix
+	}
+	if c.ListenRetryDelay == 0 {
+		c.ListenRetryDelay = DefaultListenRetryDelay
+	}
+	if c.SubscriptionMaxDuration == 0 {
+		c.SubscriptionMaxDuration = DefaultSubscriptionMaxDuration
+	}
+	if c.MidDifficultyLoad == 0 {
+		c.MidDifficultyLoad = DefaultConcurrencyMidLoad
+		if c.DifficultyMetric == DifficultyMetricRate {
+			c.MidDifficultyLoad = DefaultRateMidLoad
+		}
+	}
+	if c.MaxDifficultyLoad == 0 {
+		c.MaxDifficultyLoad = DefaultConcurrencyMaxLoad
+		if c.DifficultyMetric == DifficultyMetricRate {
+			c.MaxDifficultyLoad = DefaultRateMaxLoad
+		}
+	}
+	if c.ShutdownGracePeriod == nil {
+		grace := DefaultShutdownGracePeriod
+		c.ShutdownGracePeriod = &grace
+	}
+}
+
+// validate checks that the settings are within their bounds
+func (c *AppConfig) validate() error {
+	if err := validateReadBufferBytes("server", c.Server.ReadBufferBytes); err != nil {
+		return err
+	}
+	if err := c.Server.validatePoW(); err != nil {
+		return err
+	}
+	if err := c.Server.validatePresets(); err != nil {
+		return err
+	}
+	if strings.ContainsAny(c.Client.Software, ";\r\n") {
+		return fmt.Errorf("client.software must be a single line without ;, got %q", c.Client.Software)
+	}
+	if strings.ContainsAny(c.Server.Banner, "\r\n") {
+		return fmt.Errorf("server.banner must be a single line, got %q", c.Server.Banner)
+	}
+	if strings.ContainsAny(c.Server.Purpose, ";\r\n") {
+		return fmt.Errorf("server.purpose must not contain ';' or line breaks, got %q", c.Server.Purpose)
+	}
+	if c.Server.IdleTimeout < 0 {
+		return fmt.Errorf("server.idle_timeout must not be negative, got %s", c.Server.IdleTimeout)
+	}
+	if c.Server.SubscriptionInterval < 0 || c.Server.SubscriptionMaxDuration < 0 {
+		return fmt.Errorf("server.subscription_interval and server.subscription_max_duration must not be negative, got %s and %s",
+			c.Server.SubscriptionInterval, c.Server.SubscriptionMaxDuration)
+	}
+	if !c.Server.HashTimestampFormat.Valid() {
+		return fmt.Errorf("server.hash_timestamp_format must be %s or %s, got %q",
+			pow.TimestampRFC3339Nano, pow.TimestampEpochNanos, c.Server.HashTimestampFormat)
+	}
+	if !c.Server.NonceEncoding.Valid() {
+		return fmt.Errorf("server.nonce_encoding must be %s, %s or %s, got %q",
+			pow.NonceDecimal, pow.NonceHex, pow.NonceBase64, c.Server.NonceEncoding)
+	}
+	if !c.Client.HashTimestampFormat.Valid() {
+		return fmt.Errorf("client.hash_timestamp_format must be %s or %s, got %q",
+			pow.TimestampRFC3339Nano, pow.TimestampEpochNanos, c.Client.HashTimestampFormat)
+	}
+	if c.Server.ListenRetries < 0 || c.Server.ListenRetryDelay < 0 {
+		return fmt.Errorf("server.listen_retries and server.listen_retry_delay must not be negative, got %d and %s",
+			c.Server.ListenRetries, c.Server.ListenRetryDelay)
+	}
+	switch c.Server.QuotesSource {
+	case QuotesSourceBuiltin, QuotesSourceEmbedded:
+	case QuotesSourceFile:
+		if c.Server.QuotesFile == "" {
+			return fmt.Errorf("server.quotes_source %s needs server.quotes_file", QuotesSourceFile)
+		}
+	default:
+		return fmt.Errorf("server.quotes_source must be %s, %s or %s, got %q",
+			QuotesSourceBuiltin, QuotesSourceFile, QuotesSourceEmbedded, c.Server.QuotesSource)
+	}
+	switch c.Server.DifficultyMetric {
+	case "", DifficultyMetricConcurrency, DifficultyMetricRate:
+	default:
+		return fmt.Errorf("server.difficulty_metric must be %s or %s, got %q",
+			DifficultyMetricConcurrency, DifficultyMetricRate, c.Server.DifficultyMetric)
+	}
+	if c.Server.MidDifficultyLoad < 0 || c.Server.MaxDifficultyLoad < c.Server.MidDifficultyLoad {
+		return fmt.Errorf("server.mid_difficulty_load must not be negative nor above server.max_difficulty_load, got %d and %d",
+			c.Server.MidDifficultyLoad, c.Server.MaxDifficultyLoad)
+	}
+	switch c.Server.MalformedResponsePolicy {
+	case "", MalformedResponseGeneric, MalformedResponseHint, MalformedResponseDrop:
+	default:
+		return fmt.Errorf("server.malformed_response_policy must be %s, %s or %s, got %q",
+			MalformedResponseGeneric, MalformedResponseHint, MalformedResponseDrop, c.Server.MalformedResponsePolicy)
+	}
+	switch c.Server.QuotesOverflowPolicy {
+	case "", QuotesOverflowTruncate, QuotesOverflowError:
+	default:
+		return fmt.Errorf("server.quotes_overflow_policy must be %s or %s, got %q",
+			QuotesOverflowTruncate, QuotesOverflowError, c.Server.QuotesOverflowPolicy)
+	}
+	if c.Server.MaxDifficultyStep < 0 {
+		return fmt.Errorf("server.max_difficulty_step must not be negative, got %d", c.Server.MaxDifficultyStep)
+	}
+	if strings.Trim(c.Server.ChallengeNamespace, namespaceChars) != "" {
+		return fmt.Errorf("server.challenge_namespace may only hold letters, digits, - and _, got %q", c.Server.ChallengeNamespace)
+	}
+	for _, entry := range c.Server.DebugFilter {
+		if _, _, err := net.ParseCIDR(entry); err != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("server.debug_filter entries must be IPs or CIDRs, got %q", entry)
+		}
+	}
+	if c.Server.QuoteChunkBytes < 0 {
+		return fmt.Errorf("server.quote_chunk_bytes must not be negative, got %d", c.Server.QuoteChunkBytes)
+	}
+	if c.Server.ShutdownGracePeriod != nil && *c.Server.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("server.shutdown_grace_period must not be negative, got %s", *c.Server.ShutdownGracePeriod)
+	}
+	if c.Server.TimeWindowPerDifficulty < 0 {
+		return fmt.Errorf("server.time_window_per_difficulty must not be negative, got %s", c.Server.TimeWindowPerDifficulty)
+	}
+	if c.Server.StatsDInterval < 0 {
+		return fmt.Errorf("server.statsd_interval must not be negative, got %s", c.Server.StatsDInterval)
+	}
+	if c.Server.QuoteBucket < 0 {
+		return fmt.Errorf("server.quote_bucket must not be negative, got %s", c.Server.QuoteBucket)
+	}
+	if c.Server.VerifyTimeout < 0 {
+		return fmt.Errorf("server.verify_timeout must not be negative, got %s", c.Server.VerifyTimeout)
+	}
+	if c.Server.AcceptWatchdogInterval < 0 {
+		return fmt.Errorf("server.accept_watchdog_interval must not be negative, got %s", c.Server.AcceptWatchdogInterval)
+	}
+	if c.Client.ResponseTimeout < 0 {
+		return fmt.Errorf("client.response_timeout must not be negative, got %s", c.Client.ResponseTimeout)
+	}
+	if c.Client.SolverWorkers < 0 {
+		return fmt.Errorf("client.solver_workers must not be negative, got %d", c.Client.SolverWorkers)
+	}
+	if c.Client.MaxDifficulty < 1 || c.Client.MaxDifficulty > pow.MaxDifficulty {
+		return fmt.Errorf("client.max_difficulty must be within [1, %d], got %d", pow.MaxDifficulty, c.Client.MaxDifficulty)
+	}
+	if c.Client.SubscribeDuration < 0 {
+		return fmt.Errorf("client.subscribe_duration must not be negative, got %s", c.Client.SubscribeDuration)
+	}
+	if c.Client.MaxMessageBytes < 0 {
+		return fmt.Errorf("client.max_message_bytes must not be negative, got %d", c.Client.MaxMessageBytes)
+	}
+
+	return validateReadBufferBytes("client", c.Client.ReadBufferBytes)
+}
+
+// validatePoW rejects proof of work settings that would make the PoW
+// meaningless or impossible. The only supported hash is SHA-256 with the
+// difficulty counted in leading zero hex digits, whose bounds are
+// pow.MinDifficulty and pow.MaxDifficulty, with a positive time_window
+func (c ServerConfig) validatePoW() error {
+	if err := validateDifficultyRange("server", c.MinDifficulty, c.MaxDifficulty); err != nil {
+		return err
+	}
+	if c.TimeWindow <= 0 {
+		return fmt.Errorf("server.time_window must be positive, got %s", c.TimeWindow)
+	}
+
+	return nil
+}
+
+// validateDifficultyRange checks that [minDifficulty, maxDifficulty] is a
+// range of the sha256 hex-digit difficulty, naming the settings in what
+func validateDifficultyRange(what string, minDifficulty, maxDifficulty int) error {
+	if minDifficulty < pow.MinDifficulty || minDifficulty > maxDifficulty || maxDifficulty > pow.MaxDifficulty {
+		return fmt.Errorf("%s difficulty range [%d, %d] not allowed for sha256 hex-digit difficulty, "+
+			"want %d <= min_difficulty <= max_difficulty <= %d", what, minDifficulty, maxDifficulty, pow.MinDifficulty, pow.MaxDifficulty)
+	}
+
+	return nil
+}
+
+// validatePresets applies the difficulty rules of validatePoW to every preset
+// and checks that the active preset exists
+func (c ServerConfig) validatePresets() error {
+	for name, preset := range c.Presets {
+		if err := validateDifficultyRange(fmt.Sprintf("server preset %q", name), preset.MinDifficulty, preset.MaxDifficulty); err != nil {
+			return err
+		}
+		if preset.ConnectionTimeout <= 0 {
+			return fmt.Errorf("server preset %q conn_timeout must be positive, got %s", name, preset.ConnectionTimeout)
+		}
+	}
+	if _, ok := c.Presets[c.Preset]; c.Preset != "" && !ok {
+		return fmt.Errorf("server.preset %q is not defined in server.presets", c.Preset)
+	}
+
+	return nil
+}
+
+// validateReadBufferBytes checks the read buffer size of the given section
+func validateReadBufferBytes(section string, size int) error {
+	if size < MinReadBufferBytes || size > MaxReadBufferBytes {
+		return fmt.Errorf("%s.read_buffer_bytes must be between %d and %d, got %d",
+			section, MinReadBufferBytes, MaxReadBufferBytes, size)
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// describeUnmarshalError names the keys of the values that failed to decode,
+// as yaml only reports their line numbers
+func describeUnmarshalError(data []byte, err error) error {
+	var typeErr *yaml.TypeError
+	if !errors.As(err, &typeErr) {
+		return err
+	}
+
+	var root yaml.Node
+	if yaml.Unmarshal(data, &root) != nil {
+		return err
+	}
+	values := make(map[int][]*yaml.Node)
+	keys := make(map[*yaml.Node]string)
+	collectKeys(&root, "", values, keys)
+
+	problems := make([]string, 0, len(typeErr.Errors))
+	for _, problem := range typeErr.Errors {
+		if key := keyOf(problem, values, keys); key != "" {
+			problem = key + " (" + problem + ")"
+		}
+		problems = append(problems, problem)
+	}
+
+	return errors.New(strings.Join(problems, "; "))
+}
+
+// keyOf returns the key of the value a yaml error is about, telling values on
+// the same line apart by the value quoted in the error
+func keyOf(problem string, values map[int][]*yaml.Node, keys map[*yaml.Node]string) string {
+	var line int
+	if _, err := fmt.Sscanf(problem, "line %d:", &line); err != nil {
+		return ""
+	}
+
+	candidates := values[line]
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	if _, quoted, ok := strings.Cut(problem, "`"); ok {
+		quoted, _, _ = strings.Cut(quoted, "`")
+		for _, value := range candidates {
+			if value.Kind == yaml.ScalarNode && value.Value == quoted {
+				return keys[value]
+			}
+		}
+	}
+
+	// Otherwise the innermost value starting on the line
+	return keys[candidates[len(candidates)-1]]
+}
+
+// collectKeys indexes the value nodes by line and records their dotted key path
+func collectKeys(node *yaml.Node, path string, values map[int][]*yaml.Node, keys map[*yaml.Node]string) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			collectKeys(child, path, values, keys)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			value := node.Content[i+1]
+			values[value.Line] = append(values[value.Line], value)
+			keys[value] = key
+			collectKeys(value, key, values, keys)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+// Package logfile provides an append-only file sink that can be reopened after
+// it has been rotated externally (e.g. by logrotate)
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// File is a concurrency-safe file sink that can be reopened by path
+type File struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens (creating if needed) the file at path for appending
+func Open(path string) (*File, error) {
+	f := &File{path: path}
+	if err := f.Reopen(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Reopen closes the current file and opens path again, so writes following a
+// rename go to a fresh file
+func (f *File) Reopen() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	old := f.file
+	f.file = file
+	if old != nil {
+		return old.Close()
+	}
+
+	return nil
+}
+
+// Write appends p to the current file
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Write(p)
+}
+
+// Sync flushes the current file to disk
+func (f *File) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Sync()
+}
+
+// Close closes the current file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// Path returns the path the file is opened from
+func (f *File) Path() string {
+	return f.path
+}
@@ -0,0 +1,78 @@
+// Package loopback provides an in-memory transport built on net.Pipe, letting
+// the server and client exchange messages in-process without kernel sockets
+package loopback
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// addr is the address reported by the loopback listener
+type addr struct{}
+
+// Network returns the name of the network
+func (addr) Network() string { return "loopback" }
+
+// String returns the string form of the address
+func (addr) String() string { return "loopback" }
+
+// Listener is a net.Listener whose connections are created by Dial
+type Listener struct {
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener creates a new in-memory listener
+func NewListener() *Listener {
+	return &Listener{
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+// Accept waits for and returns the server end of the next dialed connection
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener; pending and future Accept and Dial calls fail
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+	})
+
+	return nil
+}
+
+// Addr returns the listener's address
+func (l *Listener) Addr() net.Addr {
+	return addr{}
+}
+
+// Dial creates a connection pair, hands the server end to Accept and returns
+// the client end
+func (l *Listener) Dial(ctx context.Context) (net.Conn, error) {
+	serverConn, clientConn := net.Pipe()
+
+	select {
+	case l.conns <- serverConn:
+		return clientConn, nil
+	case <-l.done:
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,29 @@
+package pow
+
+import (
+	"crypto/sha256"
+	"strings"
+	"time"
+)
+
+// DataLayout assembles the data hashed for a candidate solution from the
+// challenge, the nonce, the formatted timestamp and the extra fields the
+// challenge is bound to, e.g. its purpose. Client and server must use the
+// same layout
+type DataLayout func(challenge, nonce, timestamp string, extras ...string) []byte
+
+// CanonicalLayout concatenates the challenge, nonce, timestamp and extras in
+// that order, it is the layout of Sum
+func CanonicalLayout(challenge, nonce, timestamp string, extras ...string) []byte {
+	return []byte(challenge + nonce + timestamp + strings.Join(extras, ""))
+}
+
+// SumWith returns the hash of a candidate solution whose data is assembled by
+// layout, CanonicalLayout when nil
+func SumWith(layout DataLayout, challenge, nonce string, timestamp time.Time, format TimestampFormat, extras ...string) [sha256.Size]byte {
+	if layout == nil {
+		layout = CanonicalLayout
+	}
+
+	return sha256.Sum256(layout(challenge, nonce, format.Format(timestamp), extras...))
+}
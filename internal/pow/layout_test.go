@@ -0,0 +1,46 @@
+package pow
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// boundTo returns a layout binding solutions to the client IP, hashed first
+func boundTo(ip string) DataLayout {
+	return func(challenge, nonce, timestamp string, extras ...string) []byte {
+		return CanonicalLayout(ip+"|"+challenge, nonce, timestamp, extras...)
+	}
+}
+
+func TestDefaultLayoutIsCanonical(t *testing.T) {
+	timestamp := time.Now()
+	if SumWith(nil, "abc", "42", timestamp, "", "signup") != Sum("abc", "42", timestamp, "signup", "") {
+		t.Error("nil layout hashes unlike Sum")
+	}
+}
+
+func TestCustomLayoutRoundTrip(t *testing.T) {
+	timestamp := time.Now()
+	layout := boundTo("192.0.2.1")
+
+	var nonce string
+	for n := 0; nonce == ""; n++ {
+		if candidate := strconv.Itoa(n); HasLeadingZeros(SumWith(layout, "abc", candidate, timestamp, ""), 2) {
+			nonce = candidate
+		}
+	}
+
+	// A server using the same layout verifies it, the IP being part of the
+	// hashed data
+	sum := SumWith(boundTo("192.0.2.1"), "abc", nonce, timestamp, "")
+	if !HasLeadingZeros(sum, 2) {
+		t.Errorf("nonce %s doesn't verify with the layout it was solved with", nonce)
+	}
+	if SumWith(boundTo("192.0.2.2"), "abc", nonce, timestamp, "") == sum {
+		t.Error("the bound IP isn't hashed")
+	}
+	if Sum("abc", nonce, timestamp, "", "") == sum {
+		t.Error("custom layout hashes like the canonical one")
+	}
+}
@@ -0,0 +1,66 @@
+package pow
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+)
+
+// NonceEncoding is how nonces are written on the wire, and thus into the
+// hashed data; the server announces it with every challenge
+type NonceEncoding string
+
+const (
+	// NonceDecimal writes nonces as base-10 integers, it is the default
+	NonceDecimal NonceEncoding = "decimal"
+	// NonceHex writes nonces as lowercase hex bytes
+	NonceHex NonceEncoding = "hex"
+	// NonceBase64 writes nonces as unpadded URL-safe base64 bytes
+	NonceBase64 NonceEncoding = "base64"
+)
+
+// Valid reports whether e is a known encoding, the empty default included
+func (e NonceEncoding) Valid() bool {
+	return e == "" || e == NonceDecimal || e == NonceHex || e == NonceBase64
+}
+
+// Encode returns the nonce n in the encoding; hex and base64 encode its eight
+// big-endian bytes
+func (e NonceEncoding) Encode(n uint64) string {
+	switch e {
+	case NonceHex:
+		return hex.EncodeToString(binary.BigEndian.AppendUint64(nil, n))
+	case NonceBase64:
+		return base64.RawURLEncoding.EncodeToString(binary.BigEndian.AppendUint64(nil, n))
+	default:
+		return strconv.FormatUint(n, 10)
+	}
+}
+
+// Check reports whether nonce is well formed in the encoding. Any number of
+// digits or bytes is accepted, so clients may use random byte nonces
+func (e NonceEncoding) Check(nonce string) bool {
+	if nonce == "" {
+		return false
+	}
+
+	switch e {
+	case NonceHex:
+		_, err := hex.DecodeString(nonce)
+
+		return err == nil
+	case NonceBase64:
+		_, err := base64.RawURLEncoding.DecodeString(nonce)
+
+		return err == nil
+	default:
+		for _, r := range nonce {
+			if r < '0' || r > '9' {
+				return false
+			}
+		}
+
+		return true
+	}
+}
@@ -0,0 +1,31 @@
+package pow
+
+import "testing"
+
+func TestNonceEncodingRoundTrip(t *testing.T) {
+	tests := []struct {
+		encoding  NonceEncoding
+		want      string
+		malformed string
+	}{
+		{NonceDecimal, "258", "0x102"},
+		{NonceHex, "0000000000000102", "00zz"},
+		{NonceBase64, "AAAAAAAAAQI", "AAAAAAAAAQI="},
+	}
+
+	for _, tt := range tests {
+		nonce := tt.encoding.Encode(258)
+		if nonce != tt.want {
+			t.Errorf("%s: encoded 258 as %q, want %q", tt.encoding, nonce, tt.want)
+		}
+		if !tt.encoding.Check(nonce) {
+			t.Errorf("%s: own nonce %q fails the check", tt.encoding, nonce)
+		}
+		if tt.encoding.Check(tt.malformed) {
+			t.Errorf("%s: malformed nonce %q passes the check", tt.encoding, tt.malformed)
+		}
+		if tt.encoding.Check("") {
+			t.Errorf("%s: empty nonce passes the check", tt.encoding)
+		}
+	}
+}
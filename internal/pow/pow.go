@@ -0,0 +1,133 @@
+// Package pow holds the proof of work parameters shared by the server and client
+package pow
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"strconv"
+	"time"
+)
+
+// MinDifficulty is the lowest difficulty that still requires any work
+const MinDifficulty = 1
+
+// MaxDifficulty is the highest meaningful difficulty: the number of hex digits
+// in a SHA-256 hash
+const MaxDifficulty = sha256.Size * 2
+
+// ExpectedAttempts returns the expected number of hashes needed to find a
+// solution for the given difficulty, i.e. the number of leading zero hex
+// digits the hash must have
+func ExpectedAttempts(difficulty int) float64 {
+	return math.Pow(16, float64(difficulty))
+}
+
+// TimestampFormat is how the server's timestamp is written into the hashed
+// data; client and server must use the same
+type TimestampFormat string
+
+const (
+	// TimestampRFC3339Nano hashes the timestamp as CanonicalTimestamp, it is
+	// the default
+	TimestampRFC3339Nano TimestampFormat = "rfc3339nano"
+	// TimestampEpochNanos hashes the timestamp as decimal Unix nanoseconds,
+	// which is easier to reproduce outside Go
+	TimestampEpochNanos TimestampFormat = "epoch_nanos"
+)
+
+// Valid reports whether f is a known format, the empty default included
+func (f TimestampFormat) Valid() bool {
+	return f == "" || f == TimestampRFC3339Nano || f == TimestampEpochNanos
+}
+
+// Format returns the hashed form of the timestamp
+func (f TimestampFormat) Format(timestamp time.Time) string {
+	if f == TimestampEpochNanos {
+		return strconv.FormatInt(timestamp.UnixNano(), 10)
+	}
+
+	return CanonicalTimestamp(timestamp)
+}
+
+// Sum returns the hash of a candidate solution: the challenge, the nonce, the
+// server's timestamp of the challenge in the given format and the purpose the
+// challenge is bound to, which is empty for unbound challenges
+func Sum(challenge, nonce string, timestamp time.Time, purpose string, format TimestampFormat) [sha256.Size]byte {
+	return SumWith(CanonicalLayout, challenge, nonce, timestamp, format, purpose)
+}
+
+// CanonicalTimestamp returns the form of the timestamp that is hashed. The
+// same instant has many RFC 3339 spellings, e.g. with trailing zeros or a
+// +00:00 offset, so the hash always uses the parsed time formatted in UTC
+func CanonicalTimestamp(timestamp time.Time) string {
+	return timestamp.UTC().Format(time.RFC3339Nano)
+}
+
+// Hash returns the hex encoded hash of a candidate solution
+func Hash(challenge, nonce string, timestamp time.Time, purpose string, format TimestampFormat) string {
+	sum := Sum(challenge, nonce, timestamp, purpose, format)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// HasLeadingZeros reports whether the hash starts with difficulty zero hex
+// digits, without allocating; difficulties outside [0, MaxDifficulty] never match
+func HasLeadingZeros(sum [sha256.Size]byte, difficulty int) bool {
+	if difficulty < 0 || difficulty > MaxDifficulty {
+		return false
+	}
+
+	for i := range difficulty / 2 {
+		if sum[i] != 0 {
+			return false
+		}
+	}
+
+	// An odd difficulty also needs the high nibble of the next byte clear
+	return difficulty%2 == 0 || sum[difficulty/2]>>4 == 0
+}
+
+// Verify reports whether the nonce solves the challenge at the given difficulty
+func Verify(challenge, nonce string, timestamp time.Time, purpose string, format TimestampFormat, difficulty int) bool {
+	return HasLeadingZeros(Sum(challenge, nonce, timestamp, purpose, format), difficulty)
+}
+
+// Params are the parameters of an issued challenge a nonce can solve
+type Params struct {
+	Challenge  string
+	Timestamp  time.Time
+	Purpose    string
+	Format     TimestampFormat
+	Difficulty int
+}
+
+// VerifyAny returns the index of the first of the candidate challenges the
+// nonce solves, or -1 if it solves none of them. It serves flows accepting
+// one of several challenges, e.g. while the secret they derive from rotates
+func VerifyAny(nonce string, candidates ...Params) int {
+	for i, candidate := range candidates {
+		if Verify(candidate.Challenge, nonce, candidate.Timestamp, candidate.Purpose, candidate.Format, candidate.Difficulty) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// MeasureHashRate returns how many solution hashes per second this machine
+// computes on a single core, measured for about the given duration
+func MeasureHashRate(duration time.Duration) float64 {
+	timestamp := time.Now().UTC()
+	start := time.Now()
+
+	hashes := 0
+	for time.Since(start) < duration {
+		for range 1000 {
+			Hash("calibration", strconv.Itoa(hashes), timestamp, "", "")
+			hashes++
+		}
+	}
+
+	return float64(hashes) / time.Since(start).Seconds()
+}
@@ -0,0 +1,75 @@
+package pow
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpectedAttempts(t *testing.T) {
+	tests := []struct {
+		difficulty int
+		want       float64
+	}{
+		{0, 1},
+		{1, 16},
+		{4, 65536},
+		{8, 1 << 32},
+	}
+
+	for _, tt := range tests {
+		if got := ExpectedAttempts(tt.difficulty); got != tt.want {
+			t.Errorf("difficulty %d: %g expected attempts, want %g", tt.difficulty, got, tt.want)
+		}
+	}
+}
+
+func TestEquivalentTimestampsHashAlike(t *testing.T) {
+	canonical, err := time.Parse(time.RFC3339Nano, "2024-01-02T03:04:05.12Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Hash("abc", "42", canonical, "", TimestampRFC3339Nano)
+
+	// The same instant with trailing zeros, a zero offset and another zone
+	for _, spelling := range []string{
+		"2024-01-02T03:04:05.120000000Z",
+		"2024-01-02T03:04:05.12+00:00",
+		"2024-01-02T05:04:05.12+02:00",
+	} {
+		timestamp, err := time.Parse(time.RFC3339Nano, spelling)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Hash("abc", "42", timestamp, "", TimestampRFC3339Nano); got != want {
+			t.Errorf("%s hashed to %s, want %s as for the canonical spelling", spelling, got, want)
+		}
+	}
+}
+
+func TestVerifyAny(t *testing.T) {
+	timestamp := time.Now()
+	candidates := []Params{
+		{Challenge: "old-secret", Timestamp: timestamp, Difficulty: 3},
+		{Challenge: "new-secret", Timestamp: timestamp, Difficulty: 3},
+	}
+
+	// Solved for the second candidate only
+	var nonce string
+	for n := 0; nonce == ""; n++ {
+		candidate := strconv.Itoa(n)
+		if Verify("new-secret", candidate, timestamp, "", "", 3) && !Verify("old-secret", candidate, timestamp, "", "", 3) {
+			nonce = candidate
+		}
+	}
+
+	if got := VerifyAny(nonce, candidates...); got != 1 {
+		t.Errorf("matched candidate %d, want 1", got)
+	}
+	if got := VerifyAny(nonce, candidates[0]); got != -1 {
+		t.Errorf("matched candidate %d among none solved, want -1", got)
+	}
+	if got := VerifyAny(nonce); got != -1 {
+		t.Errorf("matched candidate %d without candidates, want -1", got)
+	}
+}
@@ -0,0 +1,38 @@
+// Package protocol holds the error codes the server reports to clients, sent
+// as Error:<code>:<message>
+package protocol
+
+import "strings"
+
+// Error codes; clients may retry on the ones marked retryable
+const (
+	// CodeLimit reports too many connections from the client, retryable
+	CodeLimit = "LIMIT"
+	// CodeBusy reports the server is overloaded, retryable
+	CodeBusy = "BUSY"
+	// CodeInternal reports a server failure, retryable
+	CodeInternal = "INTERNAL"
+	// CodeMalformed reports a response that couldn't be parsed
+	CodeMalformed = "MALFORMED"
+	// CodeMismatch reports a solution for another challenge
+	CodeMismatch = "MISMATCH"
+	// CodeExpired reports a solution that came too late; a fresh challenge
+	// solved the same way is expected to succeed
+	CodeExpired = "EXPIRED"
+	// CodeReused reports a further submission for a challenge that was
+	// already solved, e.g. by a client probing nonces
+	CodeReused = "REUSED"
+	// CodeBadPoW reports a solution that doesn't verify
+	CodeBadPoW = "BADPOW"
+)
+
+// ParseError splits the payload of an Error message into its code and
+// message; the code is empty for servers that don't send one
+func ParseError(payload string) (string, string) {
+	code, message, ok := strings.Cut(payload, ":")
+	if !ok || code == "" || strings.ToUpper(code) != code || strings.ContainsAny(code, " .") {
+		return "", payload
+	}
+
+	return code, message
+}
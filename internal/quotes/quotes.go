@@ -0,0 +1,110 @@
+// Package quotes loads the quotes served by the server
+package quotes
+
+import (
+	"bufio"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrTooManyQuotes is returned when a file holds more quotes than allowed
+var ErrTooManyQuotes = errors.New("too many quotes")
+
+// embeddedQuotes are the quotes compiled into the binary
+//
+//go:embed quotes.txt
+var embeddedQuotes string
+
+// Load reads one quote per line from the file at path, skipping blank lines and
+// lines starting with #. A line may start with a positive weight and a |, as
+// in "3|quote", to be picked more often; the weights are returned along with
+// the quotes, or nil when no line has one. At most limit quotes are read (all
+// of them when limit is 0 or less); when the file holds more, the first limit
+// quotes are returned along with ErrTooManyQuotes
+func Load(path string, limit int) ([]string, []float64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open quotes file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return parse(file, path, limit)
+}
+
+// Embedded returns the quotes compiled into the binary from quotes.txt,
+// following the rules of Load
+func Embedded(limit int) ([]string, []float64, error) {
+	return parse(strings.NewReader(embeddedQuotes), "embedded quotes", limit)
+}
+
+// parse reads the quotes from r, named name in errors, as described in Load
+func parse(r io.Reader, name string, limit int) ([]string, []float64, error) {
+	var quotes []string
+	var weights []float64
+	weighted := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if limit > 0 && len(quotes) == limit {
+			return quotes, weightsOf(weights, weighted), fmt.Errorf("%w: %s holds more than %d quotes", ErrTooManyQuotes, name, limit)
+		}
+
+		quote, weight, ok, parseErr := parseWeight(line)
+		if parseErr != nil {
+			return nil, nil, fmt.Errorf("quote %d in %s: %w", len(quotes)+1, name, parseErr)
+		}
+		weighted = weighted || ok
+		quotes = append(quotes, quote)
+		weights = append(weights, weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+
+	if len(quotes) == 0 {
+		return nil, nil, fmt.Errorf("no quotes in %s", name)
+	}
+
+	return quotes, weightsOf(weights, weighted), nil
+}
+
+// parseWeight splits the optional weight off a line, reporting whether there
+// was one; lines without a weight weigh 1
+func parseWeight(line string) (string, float64, bool, error) {
+	prefix, quote, found := strings.Cut(line, "|")
+	if !found {
+		return line, 1, false, nil
+	}
+
+	weight, err := strconv.ParseFloat(strings.TrimSpace(prefix), 64)
+	if err != nil {
+		// A | within the quote itself
+		return line, 1, false, nil
+	}
+	if weight <= 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+		return "", 0, false, fmt.Errorf("weight must be a positive number, got %s", prefix)
+	}
+
+	return strings.TrimSpace(quote), weight, true, nil
+}
+
+// weightsOf drops the weights when no quote was given one
+func weightsOf(weights []float64, weighted bool) []float64 {
+	if !weighted {
+		return nil
+	}
+
+	return weights
+}
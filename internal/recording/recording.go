@@ -0,0 +1,119 @@
+// Package recording keeps a corpus of solutions sent by real clients, so they
+// can be checked again after changes to the proof of work
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dmitriykara/word-of-wisdom-pow/internal/pow"
+)
+
+// Solution is a solved challenge as the server saw it
+type Solution struct {
+	Challenge       string    `json:"challenge"`
+	Timestamp       time.Time `json:"timestamp"`
+	Difficulty      int       `json:"difficulty"`
+	Nonce           string    `json:"nonce"`
+	ClientTimestamp time.Time `json:"client_timestamp"`
+	Purpose         string    `json:"purpose,omitempty"`
+	// TimestampFormat is how the timestamp was hashed
+	TimestampFormat pow.TimestampFormat `json:"timestamp_format,omitempty"`
+}
+
+// Recorder appends solutions to a file, one JSON object per line
+type Recorder struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens the recording at path for appending, creating it if needed
+func Open(path string) (*Recorder, error) {
+	r := &Recorder{path: path}
+	if err := r.Reopen(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reopen closes the current file and opens path again, so solutions recorded
+// after the recording was rotated go to a fresh file
+func (r *Recorder) Reopen() error {
+	file, err := os.OpenFile(r.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open recording: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old := r.file
+	r.file = file
+	if old != nil {
+		return old.Close()
+	}
+
+	return nil
+}
+
+// Path returns the path the recording is opened from
+func (r *Recorder) Path() string {
+	return r.path
+}
+
+// Record appends a solution to the recording
+func (r *Recorder) Record(solution Solution) error {
+	line, err := json.Marshal(solution)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write recording: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the recording
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// Read returns the solutions recorded at path
+func Read(path string) ([]Solution, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recording: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var solutions []Solution
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var solution Solution
+		if err := json.Unmarshal(scanner.Bytes(), &solution); err != nil {
+			return nil, fmt.Errorf("invalid recording line %d: %w", line, err)
+		}
+		solutions = append(solutions, solution)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recording: %w", err)
+	}
+
+	return solutions, nil
+}
@@ -0,0 +1,219 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Operations recorded in the file store's log
+const (
+	opIssue = "issue"
+	opTake  = "take"
+)
+
+// Every compactInterval records the log is compacted when more than
+// compactRatio of its records are dead: taken or expired
+const (
+	compactInterval = 1024
+	compactRatio    = 0.5
+)
+
+// record is a line of the file store's log
+type record struct {
+	Op        string    `json:"op"`
+	Challenge string    `json:"challenge"`
+	Issued    Challenge `json:"issued"`
+}
+
+// FileStore is a Store that survives restarts by writing every change through
+// to an append-only log, which is compacted when the store is opened and
+// whenever it is mostly dead records
+type FileStore struct {
+	memory *MemoryStore
+	path   string
+
+	// mu serializes the changes, so that the log and memory agree
+	mu   sync.Mutex
+	file *os.File
+	// records is the number of records in the log
+	records int
+}
+
+// OpenFileStore opens the store logged at path, restoring its outstanding
+// challenges; challenges expire after ttl and at most capacity are outstanding
+func OpenFileStore(path string, ttl time.Duration, capacity int) (*FileStore, error) {
+	memory := NewMemoryStore(ttl, capacity)
+	if err := restore(path, memory); err != nil {
+		return nil, err
+	}
+
+	f := &FileStore{memory: memory, path: path}
+	if err := f.compact(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Issue records a newly issued challenge. It is written to the log first, so
+// a challenge that couldn't be logged is not issued
+func (f *FileStore) Issue(challenge string, issued Challenge) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.memory.checkCapacity(); err != nil {
+		return err
+	}
+	if err := f.append(record{Op: opIssue, Challenge: challenge, Issued: issued}); err != nil {
+		return err
+	}
+
+	return f.memory.Issue(challenge, issued)
+}
+
+// Take removes an outstanding challenge, reporting whether it was found;
+// challenges taken before the last restart aren't known to be spent
+func (f *FileStore) Take(challenge string) (Challenge, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	issued, ok, err := f.memory.Take(challenge)
+	if err != nil || !ok {
+		return issued, ok, err
+	}
+
+	return issued, true, f.append(record{Op: opTake, Challenge: challenge})
+}
+
+// Reopen writes the outstanding challenges to a fresh log at path, so that
+// changes made after the log was rotated are not lost with the old one
+func (f *FileStore) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.compact()
+}
+
+// Path returns the path the log is kept at
+func (f *FileStore) Path() string {
+	return f.path
+}
+
+// Close closes the log
+func (f *FileStore) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
+
+// append writes a record to the log, compacting it when it is mostly dead
+// records. The caller must hold the lock
+func (f *FileStore) append(r record) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write replay log: %w", err)
+	}
+	f.records++
+
+	if f.records%compactInterval == 0 && float64(f.records-f.memory.liveSize()) > compactRatio*float64(f.records) {
+		// The record is already written, a failed compaction loses nothing
+		_ = f.compact()
+	}
+
+	return nil
+}
+
+// restore replays the log at path into memory; a missing log is an empty one
+func restore(path string, memory *MemoryStore) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open replay log: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			// A torn last line from a crash mid-write is skipped
+			continue
+		}
+
+		switch r.Op {
+		case opIssue:
+			memory.outstanding[r.Challenge] = r.Issued
+		case opTake:
+			delete(memory.outstanding, r.Challenge)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read replay log: %w", err)
+	}
+
+	memory.dropExpired()
+
+	return nil
+}
+
+// compact rewrites the log with only the outstanding challenges that haven't
+// expired and reopens it for appending. The caller must hold the lock, except
+// when opening the store
+func (f *FileStore) compact() error {
+	outstanding := f.memory.snapshot()
+
+	tmpPath := f.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create replay log: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for challenge, issued := range outstanding {
+		if err := encoder.Encode(record{Op: opIssue, Challenge: challenge, Issued: issued}); err != nil {
+			_ = tmp.Close()
+
+			return fmt.Errorf("failed to write replay log: %w", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+
+		return fmt.Errorf("failed to write replay log: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write replay log: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return fmt.Errorf("failed to replace replay log: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open replay log: %w", err)
+	}
+
+	if f.file != nil {
+		_ = f.file.Close()
+	}
+	f.file = file
+	f.records = len(outstanding)
+
+	return nil
+}
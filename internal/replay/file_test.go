@@ -0,0 +1,164 @@
+package replay
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.log")
+	issued := Challenge{Timestamp: time.Now(), Difficulty: 4}
+
+	store, err := OpenFileStore(path, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, challenge := range []string{"kept", "taken"} {
+		if err := store.Issue(challenge, issued); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok, err := store.Take("taken"); !ok || err != nil {
+		t.Fatalf("take before restart: ok %t, err %v", ok, err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = OpenFileStore(path, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	got, ok, err := store.Take("kept")
+	if !ok || err != nil {
+		t.Fatalf("take after restart: ok %t, err %v", ok, err)
+	}
+	if got.Difficulty != issued.Difficulty || !got.Timestamp.Equal(issued.Timestamp) {
+		t.Errorf("restored %+v, want %+v", got, issued)
+	}
+	if _, ok, _ := store.Take("taken"); ok {
+		t.Error("challenge taken before the restart is outstanding again")
+	}
+}
+
+func TestFileStoreIssueFailureLeavesMemory(t *testing.T) {
+	store, err := OpenFileStore(filepath.Join(t.TempDir(), "replay.log"), time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes to the log fail from now on
+	_ = store.file.Close()
+
+	if err := store.Issue("unlogged", Challenge{Timestamp: time.Now()}); err == nil {
+		t.Fatal("issue succeeded without writing the log")
+	}
+	if _, ok, _ := store.Take("unlogged"); ok {
+		t.Error("challenge that wasn't logged was issued")
+	}
+}
+
+func TestFileStoreCompactsDeadRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.log")
+	store, err := OpenFileStore(path, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	for i := range 4 * compactInterval {
+		challenge := fmt.Sprint(i)
+		if err := store.Issue(challenge, Challenge{Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := store.Take(challenge); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > compactInterval {
+		t.Errorf("log holds %d records, want at most %d", lines, compactInterval)
+	}
+}
+
+func TestFileStoreCompactsExpiredRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.log")
+	store, err := OpenFileStore(path, time.Minute, 2*compactInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	// Challenges issued long ago are expired by the time they are counted
+	for i := range 2 * compactInterval {
+		if err := store.Issue(fmt.Sprint(i), Challenge{Timestamp: time.Now().Add(-time.Hour)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines >= 2*compactInterval {
+		t.Errorf("log holds %d records of expired challenges, want it compacted", lines)
+	}
+}
+
+func TestFileStoreReopenAfterRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.log")
+	issued := Challenge{Timestamp: time.Now(), Difficulty: 4}
+
+	store, err := OpenFileStore(path, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Issue("before", issued); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotated away, as logrotate does, then reopened
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Issue("after", issued); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fresh log alone restores both challenges
+	store, err = OpenFileStore(path, time.Minute, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = store.Close()
+	}()
+
+	for _, challenge := range []string{"before", "after"} {
+		if _, ok, err := store.Take(challenge); !ok || err != nil {
+			t.Errorf("take %s after reopening: ok %t, err %v", challenge, ok, err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package replay tracks issued challenges so that each of them can be solved
+// only once and only while it is fresh
+package replay
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrFull is returned when too many challenges are outstanding
+var ErrFull = errors.New("too many outstanding challenges")
+
+// ErrSpent is returned when a challenge that was already taken is taken
+// again before it expired, e.g. by a client probing several nonces
+var ErrSpent = errors.New("challenge already spent")
+
+// Challenge is what is remembered about an issued challenge
+type Challenge struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Difficulty int       `json:"difficulty"`
+	// Purpose binds the challenge to a use, it is empty for unbound challenges
+	Purpose string `json:"purpose,omitempty"`
+}
+
+// Store tracks issued challenges until they are taken or expire
+type Store interface {
+	// Issue records a newly issued challenge
+	Issue(challenge string, issued Challenge) error
+	// Take removes an outstanding challenge, reporting whether it was found
+	Take(challenge string) (Challenge, bool, error)
+	// Close releases the resources held by the store
+	Close() error
+}
+
+// MemoryStore is a Store kept in memory, it is reset when the process restarts
+type MemoryStore struct {
+	ttl      time.Duration
+	capacity int
+
+	mu          sync.Mutex
+	outstanding map[string]Challenge
+	// spent remembers the taken challenges until they expire
+	spent map[string]Challenge
+}
+
+// NewMemoryStore creates a store whose challenges expire after ttl and which
+// holds at most capacity outstanding challenges
+func NewMemoryStore(ttl time.Duration, capacity int) *MemoryStore {
+	return &MemoryStore{
+		ttl:         ttl,
+		capacity:    capacity,
+		outstanding: make(map[string]Challenge),
+		spent:       make(map[string]Challenge),
+	}
+}
+
+// Issue records a newly issued challenge, dropping the ones that have expired
+func (m *MemoryStore) Issue(challenge string, issued Challenge) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropExpired()
+	if len(m.outstanding) >= m.capacity {
+		return ErrFull
+	}
+	m.outstanding[challenge] = issued
+
+	return nil
+}
+
+// Take removes an outstanding challenge, reporting whether it was found and
+// hasn't expired. Taking a challenge again while it is fresh fails with
+// ErrSpent
+func (m *MemoryStore) Take(challenge string) (Challenge, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if issued, ok := m.spent[challenge]; ok && !m.expired(issued) {
+		return Challenge{}, false, ErrSpent
+	}
+
+	issued, ok := m.outstanding[challenge]
+	delete(m.outstanding, challenge)
+	if !ok || m.expired(issued) {
+		return issued, false, nil
+	}
+
+	if len(m.spent) < m.capacity {
+		m.spent[challenge] = issued
+	}
+
+	return issued, true, nil
+}
+
+// Close does nothing for a memory store
+func (m *MemoryStore) Close() error {
+	return nil
+}
+
+// dropExpired removes the expired challenges, the caller must hold the lock
+func (m *MemoryStore) dropExpired() {
+	for challenge, issued := range m.outstanding {
+		if m.expired(issued) {
+			delete(m.outstanding, challenge)
+		}
+	}
+	for challenge, issued := range m.spent {
+		if m.expired(issued) {
+			delete(m.spent, challenge)
+		}
+	}
+}
+
+// checkCapacity returns ErrFull when no more challenges can be issued,
+// dropping the expired ones first
+func (m *MemoryStore) checkCapacity() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropExpired()
+	if len(m.outstanding) >= m.capacity {
+		return ErrFull
+	}
+
+	return nil
+}
+
+// liveSize returns the number of outstanding challenges that haven't expired
+func (m *MemoryStore) liveSize() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropExpired()
+	return len(m.outstanding)
+}
+
+// snapshot returns a copy of the outstanding challenges that haven't expired
+func (m *MemoryStore) snapshot() map[string]Challenge {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.dropExpired()
+	outstanding := make(map[string]Challenge, len(m.outstanding))
+	for challenge, issued := range m.outstanding {
+		outstanding[challenge] = issued
+	}
+
+	return outstanding
+}
+
+// expired reports whether an issued challenge is past its ttl
+func (m *MemoryStore) expired(issued Challenge) bool {
+	return time.Since(issued.Timestamp) > m.ttl
+}